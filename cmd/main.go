@@ -2,14 +2,23 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 
+	"image-upload-server/internal/cdn"
 	"image-upload-server/internal/config"
 	"image-upload-server/internal/handlers"
+	"image-upload-server/internal/logging"
 	"image-upload-server/internal/repository"
 	"image-upload-server/internal/service"
 
@@ -36,36 +45,172 @@ func main() {
 	// Load configuration
 	cfg := config.New()
 
-	// Initialize repository
-	s3Repo, err := repository.NewS3Repository(cfg.S3)
+	// Log JSON records to stdout; the default logger is replaced too so
+	// anything still using the log package ends up in the same stream
+	logger := logging.New(os.Stdout, cfg.App.LogLevel)
+	slog.SetDefault(logger)
+
+	// Initialize storage
+	store, err := repository.New(cfg.Storage, cfg.S3, logger)
+	if err != nil {
+		fatal(logger, "Failed to initialize storage", err)
+	}
+
+	// Initialize CDN invalidation, if configured
+	invalidator, err := cdn.New(cfg.CDN, cfg.S3)
 	if err != nil {
-		log.Fatalf("Failed to initialize S3 repository: %v", err)
+		fatal(logger, "Failed to initialize CDN invalidation", err)
 	}
 
 	// Initialize service
-	imgService := service.NewImageService(s3Repo)
+	if err := service.ValidatePipeline(cfg.Image.Pipeline); err != nil {
+		fatal(logger, "Invalid IMAGE_PIPELINE", err)
+	}
+	imgService := service.NewImageService(store, cfg.Image, invalidator, logger)
 
 	// Initialize handlers
-	imgHandler := handlers.NewImageHandler(imgService)
+	imgHandler := handlers.NewImageHandler(imgService, cfg.App, logger)
+
+	// Initialize authentication
+	auth, err := handlers.NewAuthenticator(cfg.Auth)
+	if err != nil {
+		fatal(logger, "Failed to initialize authentication", err)
+	}
 
 	// Setup router
-	r := setupRoutes(imgHandler)
+	r := setupRoutes(imgHandler, auth, cfg)
+	if !auth.Enabled() && !cfg.Auth.AdminWithoutAuth {
+		logger.Warn("Authentication is disabled; the move and backfill routes are not registered (set ADMIN_ROUTES_WITHOUT_AUTH to register them anyway)")
+	}
+	if !auth.Enabled() && !cfg.Auth.DebugVarsWithoutAuth {
+		logger.Warn("Authentication is disabled; /debug/vars is not registered (set DEBUG_VARS_WITHOUT_AUTH to register it anyway)")
+	}
+	if !auth.Enabled() && !cfg.Auth.MetricsWithoutAuth {
+		logger.Warn("Authentication is disabled; /metrics-lite is not registered (set METRICS_LITE_WITHOUT_AUTH to register it anyway)")
+	}
 
 	// Start server
-	log.Printf("Server starting on port %s...", cfg.App.Port)
-	log.Printf("Swagger documentation available at http://localhost:%s/swagger/index.html", cfg.App.Port)
-	log.Fatal(http.ListenAndServe(":"+cfg.App.Port, r))
+	srv := &http.Server{
+		Addr:     ":" + cfg.App.Port,
+		Handler:  r,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	if (cfg.App.TLSCertFile == "") != (cfg.App.TLSKeyFile == "") {
+		fatal(logger, "TLS_CERT_FILE and TLS_KEY_FILE must be set together", nil)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.App.TLSCertFile != "" {
+			// ListenAndServeTLS negotiates HTTP/2 via ALPN
+			logger.Info("Server starting", "port", cfg.App.Port, "tls", true,
+				"swagger", "https://localhost:"+cfg.App.Port+"/swagger/index.html")
+			serveErr <- srv.ListenAndServeTLS(cfg.App.TLSCertFile, cfg.App.TLSKeyFile)
+			return
+		}
+		logger.Info("Server starting", "port", cfg.App.Port, "tls", false,
+			"swagger", "http://localhost:"+cfg.App.Port+"/swagger/index.html")
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		fatal(logger, "Server stopped", err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process without waiting
+	stop()
+
+	shutdown(logger, srv, imgService, cfg.App.ShutdownTimeout)
+}
+
+// Helper function to stop a server gracefully: new connections are refused
+// while in-flight requests, then asynchronous uploads, get up to timeout to
+// finish, so no upload is cut off halfway through its S3 writes
+func shutdown(logger *slog.Logger, srv *http.Server, imgService *service.ImageService, timeout time.Duration) {
+	logger.Info("Shutting down, waiting for in-flight requests", "timeout", timeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("In-flight requests did not finish in time, closing their connections", "error", err)
+		srv.Close()
+	} else {
+		logger.Info("In-flight requests finished")
+	}
+	if err := imgService.WaitForJobs(ctx); err != nil {
+		logger.Error("Asynchronous uploads did not finish in time", "error", err)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		os.Exit(1)
+	}
+	logger.Info("Server stopped")
 }
 
-func setupRoutes(h *handlers.ImageHandler) *mux.Router {
+// Helper function to log a startup or server error and exit
+func fatal(logger *slog.Logger, msg string, err error) {
+	if err != nil {
+		logger.Error(msg, "error", err)
+	} else {
+		logger.Error(msg)
+	}
+	os.Exit(1)
+}
+
+// apiPrefix is the base path of all API routes
+const apiPrefix = "/api/v1"
+
+func setupRoutes(h *handlers.ImageHandler, auth *handlers.Authenticator, cfg *config.Config) http.Handler {
 	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(handlers.NotFound)
+	r.MethodNotAllowedHandler = http.HandlerFunc(handlers.MethodNotAllowed)
+
+	// Health check is registered outside the API subrouter so it stays unauthenticated
+	r.HandleFunc(apiPrefix+"/health", h.HealthCheck).Methods("GET")
+
+	// API routes. The subrouter deliberately has no PathPrefix matcher: mux
+	// copies it into every child route, which makes sibling routes clear a
+	// method mismatch and turns 405s into 404s.
+	api := r.NewRoute().Subrouter()
+	api.Use(auth.Middleware)
+	// Uploads are limited per client, after authentication so callers are
+	// told apart by identity; reads are not limited
+	limiter := handlers.NewRateLimiter(cfg.App)
+	api.Handle(apiPrefix+"/upload", limiter.Middleware(http.HandlerFunc(h.Upload))).Methods("POST")
+	api.HandleFunc(apiPrefix+"/uploads/presign", h.PresignUpload).Methods("POST")
+	api.Handle(apiPrefix+"/complete", limiter.Middleware(http.HandlerFunc(h.CompleteUpload))).Methods("POST")
+	api.HandleFunc(apiPrefix+"/process", h.Process).Methods("POST")
+	api.HandleFunc(apiPrefix+"/jobs/{id}", h.GetUploadJob).Methods("GET")
+	api.HandleFunc(apiPrefix+"/images", h.ListImages).Methods("GET")
+	api.HandleFunc(apiPrefix+"/images/{filename}", h.GetImage).Methods("GET")
+	api.HandleFunc(apiPrefix+"/images/{filename}", h.DeleteImage).Methods("DELETE")
+	api.HandleFunc(apiPrefix+"/images/{filename}/url", h.SignedURL).Methods("GET")
+	api.HandleFunc(apiPrefix+"/images/{filename}/raw", h.GetImageRaw).Methods("GET")
+	api.HandleFunc(apiPrefix+"/receipts/verify", h.VerifyReceipt).Methods("POST")
+	// Routes that rewrite stored objects wholesale are only open to
+	// anonymous callers when that is explicitly configured
+	if auth.Enabled() || cfg.Auth.AdminWithoutAuth {
+		api.HandleFunc(apiPrefix+"/images/{filename}/move", h.MoveImage).Methods("POST")
+		api.HandleFunc(apiPrefix+"/admin/backfill", h.StartBackfill).Methods("POST")
+		api.HandleFunc(apiPrefix+"/admin/backfill", h.BackfillStatus).Methods("GET")
+	}
+	// Runtime metrics, which reveal the command line and memory statistics
+	if auth.Enabled() || cfg.Auth.DebugVarsWithoutAuth {
+		api.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+	}
+	// Upload counters
+	if auth.Enabled() || cfg.Auth.MetricsWithoutAuth {
+		api.HandleFunc(apiPrefix+"/metrics-lite", h.MetricsLite).Methods("GET")
+	}
 
-	// API routes
-	api := r.PathPrefix("/api/v1").Subrouter()
-	api.HandleFunc("/upload", h.Upload).Methods("POST")
-	api.HandleFunc("/images", h.ListImages).Methods("GET")
-	api.HandleFunc("/images/{filename}", h.GetImage).Methods("GET")
-	api.HandleFunc("/health", h.HealthCheck).Methods("GET")
+	// Files of the local storage backend, public like objects in a public bucket
+	if cfg.Storage.Backend == repository.BackendLocal {
+		r.PathPrefix("/files/").Handler(handlers.LocalFiles("/files/", cfg.Storage.LocalDir)).Methods("GET", "HEAD")
+	}
 
 	// Swagger documentation
 	r.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
@@ -75,5 +220,8 @@ func setupRoutes(h *handlers.ImageHandler) *mux.Router {
 		httpSwagger.DomID("swagger-ui"),
 	))
 
-	return r
+	// Wrap the whole router rather than r.Use, which mux only runs for
+	// matched routes, so 404s and 405s get a request ID and error format
+	// too, and CORS preflights, which match no route, are answered
+	return handlers.RequestID(handlers.ErrorFormat(cfg.App)(handlers.CORS(cfg.CORS)(r)))
 }
@@ -24,6 +24,222 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/backfill": {
+            "get": {
+                "description": "Report the progress of the running or most recent format backfill",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get backfill progress",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.BackfillStatus"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Generate a copy in the given format of every existing upload-time variant, in the background and rate limited. Copies that already exist are skipped. Only one backfill runs at a time.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Start a format backfill",
+                "parameters": [
+                    {
+                        "description": "Format to add",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.BackfillRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.BackfillStatus"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/complete": {
+            "post": {
+                "description": "Process a file PUT with a presigned upload URL, like POST /upload. The staged file is removed once processed, so each token completes one upload; after a failure such as an invalid spec it can be retried until the token expires.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Process a direct upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Named processing profile supplying default format, quality, resize algorithm and presets",
+                        "name": "X-Image-Profile",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Logical collection stored as a key segment after the caller's namespace",
+                        "name": "X-Collection",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Default JPEG and WebP quality, 1-100, for specs without their own; an invalid value is ignored with a warning",
+                        "name": "X-Image-Quality",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "on"
+                        ],
+                        "type": "string",
+                        "description": "Client hint; on lowers the quality of lossy images by the server's Save-Data reduction",
+                        "name": "Save-Data",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "low"
+                        ],
+                        "type": "string",
+                        "description": "Set to low for the same reduced quality as Save-Data: on",
+                        "name": "X-Network-Quality",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "SHA-256 of the file, hex or base64; completion is rejected with 400 CHECKSUM_MISMATCH if the staged bytes differ",
+                        "name": "X-Content-SHA256",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Token and processing options",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CompleteUploadRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadResponse"
+                        },
+                        "headers": {
+                            "X-Variants": {
+                                "type": "string",
+                                "description": "Comma-separated WxH:url per compressed image, when enabled on the server"
+                            },
+                            "X-Variants-Omitted": {
+                                "type": "int",
+                                "description": "Number of compressed images left out of X-Variants to keep it within the size limit"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "string",
+                                "description": "Seconds until the client may upload again"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/health": {
             "get": {
                 "description": "Check if the API is running",
@@ -49,7 +265,7 @@ const docTemplate = `{
         },
         "/images": {
             "get": {
-                "description": "List all images in the S3 bucket",
+                "description": "List all images in the S3 bucket, scoped to the server's environment and to the caller's namespace when authenticated. Returns object keys, or key, size and modification time per image with detailed=true.",
                 "produces": [
                     "application/json"
                 ],
@@ -57,14 +273,89 @@ const docTemplate = `{
                     "images"
                 ],
                 "summary": "List all images",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only list images of this collection",
+                        "name": "X-Collection",
+                        "in": "header"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return size and modification time with each key",
+                        "name": "detailed",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "name",
+                            "size",
+                            "modified"
+                        ],
+                        "type": "string",
+                        "description": "Sort key; defaults to key order",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Sort direction; defaults to asc",
+                        "name": "order",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list keys starting with this, relative to the caller's namespace",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of images returned, applied after sorting. In key order this is the page size (at most 1000).",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Continue a key-ordered listing from the X-Next-Token of the previous page",
+                        "name": "token",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "List every environment's keys, with prefix relative to the bucket root; not available to authenticated callers or with X-Collection, and ignored unless the server allows it",
+                        "name": "all_environments",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "type": "string"
+                                "$ref": "#/definitions/models.ListedImage"
                             }
+                        },
+                        "headers": {
+                            "X-List-Warning": {
+                                "type": "string",
+                                "description": "Set when all_environments was ignored"
+                            },
+                            "X-Next-Token": {
+                                "type": "string",
+                                "description": "Token of the next page, when a paged listing has more"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "500": {
@@ -78,7 +369,7 @@ const docTemplate = `{
         },
         "/images/{filename}": {
             "get": {
-                "description": "Get information about an uploaded image by filename",
+                "description": "Get information about an uploaded image by filename; width, height and format are read from the stored image. With w and/or h, redirects to that variant of the image instead, generating it on first request when lazy variants are enabled and caching it by its transform.",
                 "produces": [
                     "application/json"
                 ],
@@ -93,6 +384,55 @@ const docTemplate = `{
                         "name": "filename",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Variant width in pixels, at most IMAGE_LAZY_VARIANT_MAX_DIMENSION (4096 unless configured)",
+                        "name": "w",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Variant height in pixels, at most IMAGE_LAZY_VARIANT_MAX_DIMENSION (4096 unless configured)",
+                        "name": "h",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Variant output format (jpeg, png, webp); defaults to the original's",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "fill",
+                            "contain",
+                            "cover"
+                        ],
+                        "type": "string",
+                        "description": "Variant fit mode",
+                        "name": "fit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Variant JPEG or WebP quality, 1-100",
+                        "name": "quality",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "nearest",
+                            "bilinear",
+                            "bicubic",
+                            "mitchell",
+                            "lanczos2",
+                            "lanczos3"
+                        ],
+                        "type": "string",
+                        "description": "Variant resize interpolation, fastest to sharpest; defaults to the server's (lanczos3 unless configured)",
+                        "name": "interpolation",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -100,6 +440,66 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/models.ImageResult"
+                        },
+                        "headers": {
+                            "Last-Modified": {
+                                "type": "string",
+                                "description": "When the stored object last changed"
+                            }
+                        }
+                    },
+                    "302": {
+                        "description": "Redirect to the variant"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete an image, optionally together with its compressed and on-demand variants",
+                "tags": [
+                    "images"
+                ],
+                "summary": "Delete an image",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Image filename",
+                        "name": "filename",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Also delete the variants sharing the image's name and token",
+                        "name": "variants",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Deleted"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "404": {
@@ -117,11 +517,11 @@ const docTemplate = `{
                 }
             }
         },
-        "/upload": {
+        "/images/{filename}/move": {
             "post": {
-                "description": "Upload and compress an image based on specified sizes, then store in S3",
+                "description": "Move an image to another key: S3 copies it and the old key is deleted. The variants made at upload move along, renamed after the destination; on-demand variants are dropped. An existing destination is only replaced with overwrite, which defaults to the server setting; its variants are deleted along with it. Only registered with authentication enabled or ADMIN_ROUTES_WITHOUT_AUTH set.",
                 "consumes": [
-                    "multipart/form-data"
+                    "application/json"
                 ],
                 "produces": [
                     "application/json"
@@ -129,28 +529,30 @@ const docTemplate = `{
                 "tags": [
                     "images"
                 ],
-                "summary": "Upload an image",
+                "summary": "Move an image",
                 "parameters": [
                     {
-                        "type": "file",
-                        "description": "Image to upload",
-                        "name": "image",
-                        "in": "formData",
+                        "type": "string",
+                        "description": "Image filename",
+                        "name": "filename",
+                        "in": "path",
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "JSON array of compression specifications [{'width': 100, 'height': 100}, ...]",
-                        "name": "compress_sizes",
-                        "in": "formData",
-                        "required": true
+                        "description": "Destination key",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.MoveRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.UploadResponse"
+                            "$ref": "#/definitions/models.ImageResult"
                         }
                     },
                     "400": {
@@ -159,6 +561,18 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -167,27 +581,1219 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
+        },
+        "/images/{filename}/raw": {
+            "get": {
+                "description": "Stream the stored bytes of an image with its Content-Type and Content-Length. A single-range Range header is passed on to storage, so interrupted downloads can resume; the range is answered with 206 and Content-Range.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Download an image",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Image filename",
+                        "name": "filename",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range to return, e.g. bytes=1024-",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Image bytes",
+                        "schema": {
+                            "type": "file"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Entity tag of the stored object"
+                            },
+                            "Last-Modified": {
+                                "type": "string",
+                                "description": "When the stored object last changed"
+                            }
+                        }
+                    },
+                    "206": {
+                        "description": "Requested range of the image",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "416": {
+                        "description": "Requested Range Not Satisfiable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/images/{filename}/url": {
+            "get": {
+                "description": "Create a time-limited GET URL for an image. Use disposition=attachment for forced-download links; the Content-Disposition filename is the image's download_filename.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Get a presigned URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Image filename",
+                        "name": "filename",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "inline",
+                            "attachment"
+                        ],
+                        "type": "string",
+                        "description": "Response Content-Disposition",
+                        "name": "disposition",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Response Content-Type override",
+                        "name": "content_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Lifetime in seconds (default from server config, max 604800)",
+                        "name": "expires",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SignedURLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs/{id}": {
+            "get": {
+                "description": "Poll an upload started with POST /upload?async=true. While it is processing, responds with 202 and its progress, including an estimated completion time once there is any to go on. Once done, responds with 200 and the upload response, or with the error the upload failed with. Finished jobs are kept for the server's retention period.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Get an asynchronous upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadJob"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "string",
+                                "description": "Seconds to wait before polling again"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/metrics-lite": {
+            "get": {
+                "description": "Cumulative upload counters since the process started, for deployments without Prometheus. Only registered with authentication enabled or METRICS_LITE_WITHOUT_AUTH set.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Get upload counters",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/process": {
+            "post": {
+                "description": "Run an image through the same processing as POST /upload but return the compressed images in a multipart/mixed response instead of storing them; the original is not returned. Each part carries the image with Content-Type, a Content-Disposition filename and X-Image-Width, X-Image-Height, X-Image-Format and X-Image-Quality headers, plus X-Image-Aspect-Policy when the extreme aspect ratio policy applied, in the requested sort order. Warnings and sizes that failed are reported in X-Image-Warning and X-Failed-Size response headers. Only available when the server allows process-only requests.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "multipart/mixed"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Process an image without storing it",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Image to process (JPEG, PNG, WebP or GIF)",
+                        "name": "image",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Named processing profile supplying default format, quality, resize algorithm and presets",
+                        "name": "X-Image-Profile",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Default JPEG and WebP quality, 1-100, for specs without their own; an invalid value is ignored with a warning",
+                        "name": "X-Image-Quality",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "on"
+                        ],
+                        "type": "string",
+                        "description": "Client hint; on lowers the quality of lossy images by the server's Save-Data reduction",
+                        "name": "Save-Data",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "low"
+                        ],
+                        "type": "string",
+                        "description": "Set to low for the same reduced quality as Save-Data: on",
+                        "name": "X-Network-Quality",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "SHA-256 of the file, hex or base64; the request is rejected with 400 CHECKSUM_MISMATCH if the received bytes differ",
+                        "name": "X-Content-SHA256",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "JSON array of compression specifications [{'width': 100, 'height': 100}, ...]; required unless a preset applies; interpolation per spec as for POST /upload",
+                        "name": "compress_sizes",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Named size set of the profile, used instead of compress_sizes",
+                        "name": "preset",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "request",
+                            "area_asc",
+                            "area_desc"
+                        ],
+                        "type": "string",
+                        "description": "Order of the parts; defaults to the server setting",
+                        "name": "sort",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Default output format for specs without their own (jpeg, png, webp, gif, auto); defaults to the source format",
+                        "name": "format",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Use lossless WebP for webp specs without their own lossless field",
+                        "name": "lossless",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "none",
+                            "best_speed",
+                            "default",
+                            "best_compression"
+                        ],
+                        "type": "string",
+                        "description": "zlib effort for PNG output, as for POST /upload",
+                        "name": "png_compression",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Brightness shift in percent of full scale, -100 to 100, applied before resizing",
+                        "name": "brightness",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Contrast change in percent around mid-grey, -100 to 100, applied before resizing",
+                        "name": "contrast",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Crop uniform-colour borders before resizing",
+                        "name": "trim",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "default": 10,
+                        "description": "How far in percent of full scale a border pixel may differ from the corner colour, 0 to 100",
+                        "name": "trim_tolerance",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "multipart/mixed body with one part per compressed image",
+                        "schema": {
+                            "type": "file"
+                        },
+                        "headers": {
+                            "X-Failed-Size": {
+                                "type": "string",
+                                "description": "Size that could not be produced, as WIDTHxHEIGHT FORMAT: error"
+                            },
+                            "X-Image-Warning": {
+                                "type": "string",
+                                "description": "Non-fatal adjustment made while processing, one header per warning"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/receipts/verify": {
+            "post": {
+                "description": "Check that an upload response's receipt was issued by this server and matches its images. The signature is a hex HMAC-SHA256 over \"HMAC-SHA256-v1\", issued_at (RFC 3339, UTC) and one \"\u003curl\u003e \u003cwidth\u003ex\u003cheight\u003e \u003cformat\u003e\" line per image, original first, joined by newlines.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Verify an upload receipt",
+                "parameters": [
+                    {
+                        "description": "Upload response including its receipt",
+                        "name": "response",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadResponse"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReceiptVerification"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/upload": {
+            "post": {
+                "description": "Upload and compress an image based on specified sizes, then store in S3. When the server allows batches, repeat the image field to upload several images with the same options: the response is then a models.BatchUploadResponse with a result per image, so one bad file doesn't fail the others. Batches can't be asynchronous or use X-Content-SHA256, and don't set X-Variants.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Upload an image",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Image to upload (JPEG, PNG, WebP or GIF; animated GIFs stay animated for gif output); repeat for a batch, up to the server's limit",
+                        "name": "image",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Named processing profile supplying default format, quality, resize algorithm and presets",
+                        "name": "X-Image-Profile",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Logical collection stored as a key segment after the caller's namespace; letters, digits, '.', '-' and '_', up to 64 characters",
+                        "name": "X-Collection",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Default JPEG and WebP quality, 1-100, for specs without their own; an invalid value is ignored with a warning",
+                        "name": "X-Image-Quality",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "on"
+                        ],
+                        "type": "string",
+                        "description": "Client hint; on lowers the quality of lossy images by the server's Save-Data reduction",
+                        "name": "Save-Data",
+                        "in": "header"
+                    },
+                    {
+                        "enum": [
+                            "low"
+                        ],
+                        "type": "string",
+                        "description": "Set to low for the same reduced quality as Save-Data: on",
+                        "name": "X-Network-Quality",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "SHA-256 of the file, hex or base64; the upload is rejected with 400 CHECKSUM_MISMATCH if the received bytes differ",
+                        "name": "X-Content-SHA256",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "JSON array of compression specifications [{'width': 100, 'height': 100}, ...]; required unless a preset applies. A spec's interpolation trades speed for quality: nearest and bilinear are fastest but alias and blur, bicubic and mitchell are a middle ground, lanczos2 and lanczos3 (the default) are sharpest and slowest.",
+                        "name": "compress_sizes",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Named size set of the profile, used instead of compress_sizes",
+                        "name": "preset",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "S3 storage class for the original, e.g. GLACIER; defaults to the server setting",
+                        "name": "storage_class",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "S3 storage class for the compressed images; defaults to the server setting",
+                        "name": "variant_storage_class",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "request",
+                            "area_asc",
+                            "area_desc"
+                        ],
+                        "type": "string",
+                        "description": "Order of compressed_images; defaults to the server setting (request order unless configured)",
+                        "name": "sort",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include processing diagnostics; only when the server allows debug responses",
+                        "name": "debug",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include a 256-bucket histogram per channel of the decoded image",
+                        "name": "histogram",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Process in the background: responds with 202 and a Location to poll with GET /jobs/{id}; only when the server allows asynchronous uploads",
+                        "name": "async",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Optional sub-path to store the images under, e.g. products/shoes",
+                        "name": "folder",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Default output format for specs without their own (jpeg, png, webp, gif, auto); defaults to the source format. auto picks per variant from sampled content: PNG for flat graphics (at most 256 colours or mostly flat areas), lossy WebP for photos with transparency, JPEG for other photos.",
+                        "name": "format",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "none",
+                            "best_speed",
+                            "default",
+                            "best_compression"
+                        ],
+                        "type": "string",
+                        "description": "zlib effort for PNG output: best_compression gives the smallest files for the most CPU, best_speed is fastest but larger, none skips compression; defaults to the server setting. An invalid value is ignored with a warning.",
+                        "name": "png_compression",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Use lossless WebP for webp specs without their own lossless field. Much smaller than lossy for flat-colour graphics and screenshots, usually larger for photos.",
+                        "name": "lossless",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Brightness shift in percent of full scale, -100 to 100, applied before resizing",
+                        "name": "brightness",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Contrast change in percent around mid-grey, -100 to 100, applied before resizing",
+                        "name": "contrast",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Crop uniform-colour borders, taking the top-left pixel as the border colour, before resizing",
+                        "name": "trim",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "default": 10,
+                        "description": "How far in percent of full scale a border pixel may differ from the corner colour, 0 to 100",
+                        "name": "trim_tolerance",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadResponse"
+                        },
+                        "headers": {
+                            "X-Upload-Warning": {
+                                "type": "string",
+                                "description": "Set when the file exceeds the recommended upload size"
+                            },
+                            "X-Variants": {
+                                "type": "string",
+                                "description": "Comma-separated WxH:url per compressed image, when enabled on the server"
+                            },
+                            "X-Variants-Omitted": {
+                                "type": "int",
+                                "description": "Number of compressed images left out of X-Variants to keep it within the size limit"
+                            }
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadJob"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Polling URL of the asynchronous upload"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "string",
+                                "description": "Seconds until the client may upload again"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        },
+                        "headers": {
+                            "Retry-After": {
+                                "type": "string",
+                                "description": "Seconds to wait before retrying"
+                            }
+                        }
+                    },
+                    "504": {
+                        "description": "Gateway Timeout",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/uploads/presign": {
+            "post": {
+                "description": "Issue a presigned PUT to upload a file straight to S3, and a token to complete it with. PUT exactly size bytes to upload_url with the returned headers, then call POST /complete with the token before expires_at to process the file.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "images"
+                ],
+                "summary": "Get a presigned upload URL",
+                "parameters": [
+                    {
+                        "description": "File to upload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.DirectUploadRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.DirectUploadResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
     "definitions": {
+        "models.BackfillRequest": {
+            "type": "object",
+            "properties": {
+                "format": {
+                    "description": "Format to add for every existing variant size",
+                    "type": "string",
+                    "example": "webp"
+                }
+            }
+        },
+        "models.BackfillStatus": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "description": "Variants generated",
+                    "type": "integer",
+                    "example": 150
+                },
+                "failed": {
+                    "description": "Originals that couldn't be converted",
+                    "type": "integer",
+                    "example": 1
+                },
+                "finished_at": {
+                    "description": "When it ended",
+                    "type": "string",
+                    "example": "2024-05-01T12:05:00Z"
+                },
+                "format": {
+                    "description": "Format being added",
+                    "type": "string",
+                    "example": "webp"
+                },
+                "last_error": {
+                    "description": "Most recent failure",
+                    "type": "string",
+                    "example": "photo.jpg: failed to decode"
+                },
+                "processed": {
+                    "description": "Originals handled so far",
+                    "type": "integer",
+                    "example": 40
+                },
+                "skipped": {
+                    "description": "Variants that already existed in the format",
+                    "type": "integer",
+                    "example": 10
+                },
+                "started_at": {
+                    "description": "When the backfill began",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:00Z"
+                },
+                "state": {
+                    "description": "idle, running or finished",
+                    "type": "string",
+                    "example": "running"
+                },
+                "total": {
+                    "description": "Originals found",
+                    "type": "integer",
+                    "example": 120
+                }
+            }
+        },
+        "models.CompleteUploadRequest": {
+            "type": "object",
+            "properties": {
+                "brightness": {
+                    "description": "Brightness shift in percent of full scale, -100 to 100",
+                    "type": "number",
+                    "example": 10
+                },
+                "compress_sizes": {
+                    "description": "Sizes to generate; required unless a preset applies",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CompressSpec"
+                    }
+                },
+                "contrast": {
+                    "description": "Contrast change in percent around mid-grey, -100 to 100",
+                    "type": "number",
+                    "example": 5
+                },
+                "folder": {
+                    "description": "Optional sub-path to store the images under",
+                    "type": "string",
+                    "example": "avatars"
+                },
+                "format": {
+                    "description": "Default output format for specs without their own",
+                    "type": "string",
+                    "example": "webp"
+                },
+                "histogram": {
+                    "description": "Include a 256-bucket histogram per channel of the decoded image",
+                    "type": "boolean",
+                    "example": false
+                },
+                "lossless": {
+                    "description": "The processing options of a multipart upload, with the same meaning and defaults",
+                    "type": "boolean",
+                    "example": false
+                },
+                "png_compression": {
+                    "description": "zlib effort for PNG output; an invalid value is ignored with a warning",
+                    "type": "string",
+                    "example": "best_speed"
+                },
+                "preset": {
+                    "description": "Named size set of the profile",
+                    "type": "string"
+                },
+                "sort": {
+                    "description": "Order of compressed_images",
+                    "type": "string",
+                    "example": "area_asc"
+                },
+                "storage_class": {
+                    "description": "S3 storage class for the original; defaults to the server setting",
+                    "type": "string",
+                    "example": "GLACIER"
+                },
+                "token": {
+                    "description": "Token returned with the upload URL",
+                    "type": "string"
+                },
+                "trim": {
+                    "description": "Crop uniform-colour borders before resizing",
+                    "type": "boolean",
+                    "example": false
+                },
+                "trim_tolerance": {
+                    "description": "Border colour tolerance in percent of full scale, 0 to 100; defaults to 10",
+                    "type": "number",
+                    "example": 10
+                },
+                "variant_storage_class": {
+                    "description": "S3 storage class for the compressed images; defaults to the server setting",
+                    "type": "string",
+                    "example": "STANDARD_IA"
+                }
+            }
+        },
+        "models.CompressSpec": {
+            "type": "object",
+            "properties": {
+                "fit": {
+                    "description": "How to handle a different aspect ratio: fill (stretch, default), contain or cover",
+                    "type": "string",
+                    "example": "cover"
+                },
+                "format": {
+                    "description": "Output format (jpeg, png, webp, gif, or auto to pick by content); defaults to the request format",
+                    "type": "string",
+                    "example": "jpeg"
+                },
+                "height": {
+                    "description": "Height in pixels; 0 scales to the width, e.g. {width: 800, height: 0}",
+                    "type": "integer",
+                    "example": 600
+                },
+                "interpolation": {
+                    "description": "Resize interpolation, fastest to sharpest: nearest, bilinear, bicubic,\nmitchell, lanczos2 or lanczos3; defaults to the profile or server algorithm",
+                    "type": "string",
+                    "example": "bilinear"
+                },
+                "lossless": {
+                    "description": "Lossless WebP for this spec, overriding the request's lossless field",
+                    "type": "boolean",
+                    "example": false
+                },
+                "quality": {
+                    "description": "JPEG and lossy WebP quality, 1-100; defaults to the profile or server quality, ignored by PNG and GIF",
+                    "type": "integer",
+                    "example": 92
+                },
+                "width": {
+                    "description": "Width in pixels; 0 scales to the height keeping the aspect ratio",
+                    "type": "integer",
+                    "example": 800
+                }
+            }
+        },
+        "models.Diagnostics": {
+            "type": "object",
+            "properties": {
+                "color_model": {
+                    "description": "Decoded pixel layout",
+                    "type": "string",
+                    "example": "YCbCr 4:2:0"
+                },
+                "detected_format": {
+                    "description": "Format the decoder recognised",
+                    "type": "string",
+                    "example": "jpeg"
+                },
+                "exif_rotated": {
+                    "description": "Whether an EXIF orientation was applied",
+                    "type": "boolean",
+                    "example": false
+                },
+                "resize_algorithm": {
+                    "description": "Interpolation used for variants",
+                    "type": "string",
+                    "example": "lanczos3"
+                },
+                "timings_ms": {
+                    "description": "Time per processing stage in milliseconds",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
+                "warnings": {
+                    "description": "Non-fatal adjustments and failures",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.DirectUploadRequest": {
+            "type": "object",
+            "properties": {
+                "content_type": {
+                    "description": "Content type the PUT is sent with",
+                    "type": "string",
+                    "example": "image/jpeg"
+                },
+                "filename": {
+                    "description": "Upload name, with a JPG, PNG, WebP or GIF extension",
+                    "type": "string",
+                    "example": "photo.jpg"
+                },
+                "size": {
+                    "description": "Exact size of the file in bytes",
+                    "type": "integer",
+                    "example": 204800
+                }
+            }
+        },
+        "models.DirectUploadResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "When the URL and token expire",
+                    "type": "string",
+                    "example": "2024-05-01T12:15:00Z"
+                },
+                "headers": {
+                    "description": "Headers the PUT must send exactly as given",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "method": {
+                    "description": "HTTP method of the upload",
+                    "type": "string",
+                    "example": "PUT"
+                },
+                "token": {
+                    "description": "Signed token for POST /complete",
+                    "type": "string"
+                },
+                "upload_url": {
+                    "description": "URL to PUT the file to",
+                    "type": "string"
+                }
+            }
+        },
         "models.ErrorResponse": {
             "type": "object",
             "properties": {
+                "code": {
+                    "description": "Machine-readable error code",
+                    "type": "string",
+                    "example": "UNSUPPORTED_FILE_TYPE"
+                },
                 "error": {
                     "description": "Error message",
                     "type": "string",
                     "example": "Invalid file format"
+                },
+                "request_id": {
+                    "description": "ID of the request, as in the X-Request-ID header",
+                    "type": "string",
+                    "example": "4f9c2b1e7a3d4c5e8f90a1b2c3d4e5f6"
+                }
+            }
+        },
+        "models.FailedSize": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Why it failed",
+                    "type": "string",
+                    "example": "failed to upload: timeout"
+                },
+                "format": {
+                    "description": "Output format",
+                    "type": "string",
+                    "example": "jpeg"
+                },
+                "height": {
+                    "description": "Requested height in pixels",
+                    "type": "integer",
+                    "example": 600
+                },
+                "width": {
+                    "description": "Requested width in pixels",
+                    "type": "integer",
+                    "example": 800
+                }
+            }
+        },
+        "models.Histogram": {
+            "type": "object",
+            "properties": {
+                "alpha": {
+                    "description": "Pixels per alpha value",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "blue": {
+                    "description": "Pixels per blue value",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "green": {
+                    "description": "Pixels per green value",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "red": {
+                    "description": "Pixels per red value",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
                 }
             }
         },
         "models.ImageResult": {
             "type": "object",
             "properties": {
+                "aspect_policy": {
+                    "description": "Policy applied because the source's aspect ratio was too extreme for the cover spec: crop or pad",
+                    "type": "string",
+                    "example": "pad"
+                },
+                "backend": {
+                    "description": "Storage backend holding the image",
+                    "type": "string",
+                    "example": "s3"
+                },
+                "download_filename": {
+                    "description": "Suggested filename for saving the image",
+                    "type": "string",
+                    "example": "photo-800x600.jpg"
+                },
+                "format": {
+                    "description": "Encoded format",
+                    "type": "string",
+                    "example": "jpeg"
+                },
                 "height": {
                     "description": "Height in pixels",
                     "type": "integer",
                     "example": 1080
                 },
+                "key": {
+                    "description": "Object key the image is stored under",
+                    "type": "string",
+                    "example": "uploads/file.jpg"
+                },
+                "last_modified": {
+                    "description": "When the stored object last changed",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:00Z"
+                },
+                "lossless": {
+                    "description": "Set for lossless WebP",
+                    "type": "boolean",
+                    "example": false
+                },
+                "quality": {
+                    "description": "Lossy encoding quality used, omitted for lossless formats",
+                    "type": "integer",
+                    "example": 85
+                },
+                "quality_clamped": {
+                    "description": "Set when the quality was raised to the configured minimum",
+                    "type": "boolean",
+                    "example": false
+                },
+                "scale_x": {
+                    "description": "Horizontal scale applied to the source, variant over source width; with fit cover the uniform scale before cropping",
+                    "type": "number",
+                    "example": 0.5
+                },
+                "scale_y": {
+                    "description": "Vertical scale applied to the source, variant over source height",
+                    "type": "number",
+                    "example": 0.5
+                },
+                "uploaded_at": {
+                    "description": "Upload time encoded in the key, if present",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:00Z"
+                },
                 "url": {
                     "description": "S3 URL of the image",
                     "type": "string",
@@ -200,9 +1806,134 @@ const docTemplate = `{
                 }
             }
         },
+        "models.ListedImage": {
+            "type": "object",
+            "properties": {
+                "key": {
+                    "description": "Object key",
+                    "type": "string",
+                    "example": "products/shoes/photo_1714564800000000000.jpg"
+                },
+                "last_modified": {
+                    "description": "When the object last changed",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:00Z"
+                },
+                "size": {
+                    "description": "Object size in bytes",
+                    "type": "integer",
+                    "example": 204800
+                }
+            }
+        },
+        "models.MoveRequest": {
+            "type": "object",
+            "properties": {
+                "destination": {
+                    "description": "New object key",
+                    "type": "string",
+                    "example": "products/shoes/photo.jpg"
+                },
+                "overwrite": {
+                    "description": "Replace an existing object at the destination; defaults to the server setting",
+                    "type": "boolean",
+                    "example": false
+                }
+            }
+        },
+        "models.ReceiptVerification": {
+            "type": "object",
+            "properties": {
+                "valid": {
+                    "description": "Whether the receipt matches the images and was issued by this server",
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "models.SignedURLResponse": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "When the URL stops working",
+                    "type": "string",
+                    "example": "2024-05-01T12:15:00Z"
+                },
+                "url": {
+                    "description": "Presigned GET URL",
+                    "type": "string",
+                    "example": "https://bucket.s3.region.amazonaws.com/file.jpg?X-Amz-Signature=..."
+                }
+            }
+        },
+        "models.UploadJob": {
+            "type": "object",
+            "properties": {
+                "completed_sizes": {
+                    "description": "Compressed sizes done so far",
+                    "type": "integer",
+                    "example": 2
+                },
+                "estimated_completion": {
+                    "description": "Expected finish, once there is progress or history to go on",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:05Z"
+                },
+                "finished_at": {
+                    "description": "When processing ended",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:04Z"
+                },
+                "id": {
+                    "description": "Job ID, part of the polling URL",
+                    "type": "string",
+                    "example": "3f9a1c2b7d4e5f60a1b2c3d4e5f60718"
+                },
+                "started_at": {
+                    "description": "When the job was accepted",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:00Z"
+                },
+                "state": {
+                    "description": "processing, finished or failed",
+                    "type": "string",
+                    "example": "processing"
+                },
+                "total_sizes": {
+                    "description": "Compressed sizes to produce, zero until planned",
+                    "type": "integer",
+                    "example": 4
+                }
+            }
+        },
+        "models.UploadReceipt": {
+            "type": "object",
+            "properties": {
+                "algorithm": {
+                    "description": "Signing scheme",
+                    "type": "string",
+                    "example": "HMAC-SHA256-v1"
+                },
+                "issued_at": {
+                    "description": "When the receipt was signed",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:00Z"
+                },
+                "signature": {
+                    "description": "Hex-encoded signature",
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2f..."
+                }
+            }
+        },
         "models.UploadResponse": {
             "type": "object",
             "properties": {
+                "collection": {
+                    "description": "Collection the images were stored under, from X-Collection",
+                    "type": "string",
+                    "example": "spring-catalog"
+                },
                 "compressed_images": {
                     "description": "Information about all compressed versions",
                     "type": "array",
@@ -210,18 +1941,84 @@ const docTemplate = `{
                         "$ref": "#/definitions/models.ImageResult"
                     }
                 },
+                "content_sha256": {
+                    "description": "Hex SHA-256 of the uploaded bytes",
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "diagnostics": {
+                    "description": "Processing details, only for debug requests",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Diagnostics"
+                        }
+                    ]
+                },
+                "failed_sizes": {
+                    "description": "Sizes that couldn't be encoded or stored",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FailedSize"
+                    }
+                },
+                "histogram": {
+                    "description": "Per-channel histogram of the decoded source, only with histogram=true",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Histogram"
+                        }
+                    ]
+                },
                 "message": {
                     "description": "Status message",
                     "type": "string",
                     "example": "Image uploaded and processed successfully"
                 },
                 "original_image": {
-                    "description": "Information about the original image",
+                    "description": "The stored original; its dimensions can differ from the source's",
                     "allOf": [
                         {
                             "$ref": "#/definitions/models.ImageResult"
                         }
                     ]
+                },
+                "original_reencoded": {
+                    "description": "Set when the stored original was re-encoded rather than kept byte-for-byte",
+                    "type": "boolean",
+                    "example": false
+                },
+                "profile": {
+                    "description": "Processing profile applied, from X-Image-Profile",
+                    "type": "string",
+                    "example": "mobile"
+                },
+                "receipt": {
+                    "description": "Signed record of the upload, when receipts are enabled",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.UploadReceipt"
+                        }
+                    ]
+                },
+                "source_height": {
+                    "description": "Height of the uploaded image as decoded",
+                    "type": "integer",
+                    "example": 3024
+                },
+                "source_width": {
+                    "description": "Width of the uploaded image as decoded",
+                    "type": "integer",
+                    "example": 4032
+                },
+                "warnings": {
+                    "description": "Non-fatal adjustments made while processing",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "1600x1200 reduced to 800x600 to avoid upscaling"
+                    ]
                 }
             }
         }
@@ -0,0 +1,124 @@
+// internal/cdn/cdn.go
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+
+	"image-upload-server/internal/config"
+)
+
+// Supported CDN providers
+const (
+	ProviderNone       = "none"
+	ProviderCloudFront = "cloudfront"
+	ProviderWebhook    = "webhook"
+)
+
+// Invalidator purges cached copies of objects from a CDN
+type Invalidator interface {
+	Invalidate(ctx context.Context, keys []string) error
+}
+
+// New creates the invalidator selected by the config, or nil when disabled
+func New(cfg config.CDNConfig, s3cfg config.S3Config) (Invalidator, error) {
+	switch cfg.Provider {
+	case "", ProviderNone:
+		return nil, nil
+	case ProviderCloudFront:
+		if cfg.DistributionID == "" {
+			return nil, fmt.Errorf("cloudfront invalidation requires CDN_DISTRIBUTION_ID")
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.TODO(),
+			awsconfig.WithRegion(s3cfg.Region),
+			awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+				s3cfg.AccessKeyID,
+				s3cfg.SecretAccessKey,
+				"",
+			)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return &cloudFrontInvalidator{
+			client:         cloudfront.NewFromConfig(awsCfg),
+			distributionID: cfg.DistributionID,
+		}, nil
+	case ProviderWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook invalidation requires CDN_WEBHOOK_URL")
+		}
+		return &webhookInvalidator{
+			url:    cfg.WebhookURL,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown CDN provider %q", cfg.Provider)
+	}
+}
+
+// cloudFrontInvalidator creates CloudFront invalidations for object paths
+type cloudFrontInvalidator struct {
+	client         *cloudfront.Client
+	distributionID string
+}
+
+func (c *cloudFrontInvalidator) Invalidate(ctx context.Context, keys []string) error {
+	paths := make([]string, len(keys))
+	for i, key := range keys {
+		paths[i] = "/" + key
+	}
+
+	_, err := c.client.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(c.distributionID),
+		InvalidationBatch: &types.InvalidationBatch{
+			CallerReference: aws.String(strconv.FormatInt(time.Now().UnixNano(), 10)),
+			Paths: &types.Paths{
+				Items:    paths,
+				Quantity: aws.Int32(int32(len(paths))),
+			},
+		},
+	})
+	return err
+}
+
+// webhookInvalidator POSTs the affected keys as {"keys": [...]} to a URL
+type webhookInvalidator struct {
+	url    string
+	client *http.Client
+}
+
+func (w *webhookInvalidator) Invalidate(ctx context.Context, keys []string) error {
+	body, err := json.Marshal(map[string][]string{"keys": keys})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,580 @@
+// internal/config/config.go
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds all configuration for the application
+type Config struct {
+	App     AppConfig
+	CORS    CORSConfig
+	Storage StorageConfig
+	S3      S3Config
+	Auth    AuthConfig
+	Image   ImageConfig
+	CDN     CDNConfig
+}
+
+// AppConfig holds HTTP server settings
+type AppConfig struct {
+	Port string
+	// MaxUploadBytes is the hard limit for an upload request
+	MaxUploadBytes int64
+	// UploadSoftLimitBytes is the size above which an upload still succeeds
+	// but the response carries an X-Upload-Warning header. Zero disables it.
+	UploadSoftLimitBytes int64
+	// MaxBatchFiles is how many images one upload request may carry, each
+	// within MaxUploadBytes; one disables batch uploads
+	MaxBatchFiles int
+	// UploadRateLimit is how many uploads per second each client may make,
+	// with bursts of up to UploadRateBurst; clients are told apart by API key,
+	// or by IP address. Zero disables the limit.
+	UploadRateLimit float64
+	UploadRateBurst int
+	// TrustForwardedFor takes the client IP from X-Forwarded-For, for servers
+	// behind a proxy or load balancer that sets it
+	TrustForwardedFor bool
+	// ErrorFormat is "default" for ErrorResponse bodies or "problem" for RFC 7807
+	// problem+json; clients can also ask for problem+json via the Accept header
+	ErrorFormat string
+	// ProblemTypeBaseURL prefixes the type URI of problem+json errors
+	ProblemTypeBaseURL string
+	// AllowDebug lets uploads request processing diagnostics with ?debug=true
+	AllowDebug bool
+	// AllowProcessOnly enables POST /process, which returns the generated
+	// variants in the response instead of storing anything
+	AllowProcessOnly bool
+	// AllowAllEnvironments honours all_environments=true on listings, which
+	// reveals every environment's keys; otherwise the parameter is ignored
+	AllowAllEnvironments bool
+	// VariantsHeader adds an X-Variants header listing "WxH:url" per compressed
+	// image to upload responses, for proxies that don't parse the body. Entries
+	// that would take it past VariantsHeaderMaxBytes are left out.
+	VariantsHeader         bool
+	VariantsHeaderMaxBytes int
+	// TLSCertFile and TLSKeyFile enable HTTPS, with HTTP/2, when both are set;
+	// the server speaks plain HTTP otherwise
+	TLSCertFile string
+	TLSKeyFile  string
+	// ShutdownTimeout is how long in-flight requests and asynchronous
+	// uploads get to finish after SIGINT or SIGTERM before the server exits
+	ShutdownTimeout time.Duration
+	// LogLevel is "info", or "debug" to also log routine events such as
+	// clients disconnecting mid-request
+	LogLevel string
+}
+
+// CORSConfig holds the cross-origin settings for browser clients
+type CORSConfig struct {
+	// AllowedOrigins lists the origins browsers may call the API from, such
+	// as "https://app.example.com", "https://*.example.com" for subdomains or
+	// "*" for any origin. Empty disables CORS.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers preflights may ask for; "*"
+	// allows whichever are requested
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts can read
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight result
+	MaxAge time.Duration
+}
+
+// S3Config holds S3 connection settings
+type S3Config struct {
+	BucketName      string
+	Region          string
+	Endpoint        string // Optional custom endpoint (MinIO, LocalStack)
+	AccessKeyID     string
+	SecretAccessKey string
+	PresignExpiry   time.Duration // Default lifetime of presigned URLs
+	// UsePresignedURLs returns presigned GET URLs instead of public object URLs
+	// in upload and image responses, for private buckets
+	UsePresignedURLs bool
+	StorageClass     string // Default storage class for new objects; empty uses the bucket default
+	// Files above MultipartThreshold (capped at the 5GB single-part limit)
+	// are uploaded in MultipartPartSize parts; with MultipartEnabled off
+	// they are rejected instead
+	MultipartEnabled   bool
+	MultipartThreshold int64
+	MultipartPartSize  int64
+	// AutoDetectRegion switches to the bucket's actual region when it differs
+	// from Region; otherwise a mismatch fails startup with the correct region
+	AutoDetectRegion bool
+	// MinTLSVersion is the lowest TLS version ("1.2", "1.3") accepted on S3 connections
+	MinTLSVersion string
+	// ExistenceCacheTTL keeps HeadObject results, found or missing, for this
+	// long, up to ExistenceCacheSize keys; a zero TTL disables the cache
+	ExistenceCacheTTL  time.Duration
+	ExistenceCacheSize int
+	// OperationTimeout bounds each S3 call, including a whole multipart
+	// upload, in addition to the request's own cancellation; zero disables it
+	OperationTimeout time.Duration
+}
+
+// StorageConfig selects where images are stored
+type StorageConfig struct {
+	Backend  string // "s3", or "local" to use a directory instead
+	LocalDir string // Directory the local backend stores files in
+	// LocalBaseURL is where clients reach the local files, which the server
+	// serves under /files/
+	LocalBaseURL string
+}
+
+// AuthConfig holds API authentication settings
+type AuthConfig struct {
+	Mode        string   // "none", "jwt" or "apikey"
+	APIKeys     []string // Keys accepted in apikey mode, from a comma-separated list
+	JWTSecret   string   // Shared secret for HMAC-signed tokens
+	JWKSURL     string   // Key set URL for RSA-signed tokens; takes precedence over JWTSecret
+	JWTAudience string   // Required "aud" claim, if set
+	JWTIssuer   string   // Required "iss" claim, if set
+	// AdminWithoutAuth registers the move and backfill routes even in "none"
+	// mode, where anyone could call them; meant for local development
+	AdminWithoutAuth bool
+	// DebugVarsWithoutAuth registers /debug/vars in "none" mode; it exposes
+	// the command line and memory statistics, so it is off by default
+	DebugVarsWithoutAuth bool
+	// MetricsWithoutAuth registers /metrics-lite in "none" mode, for
+	// monitoring that cannot authenticate; off by default
+	MetricsWithoutAuth bool
+}
+
+// ImageConfig holds image processing settings
+type ImageConfig struct {
+	Quality int // Default lossy encoding quality (1-100)
+	// PNGCompression is the zlib effort for PNG output unless a request asks
+	// for another: default, best_speed, best_compression or none
+	PNGCompression string
+	// ResizeAlgorithm is the interpolation used for variants unless the
+	// profile or the spec names another: nearest, bilinear, bicubic,
+	// mitchell, lanczos2 or lanczos3
+	ResizeAlgorithm string
+	// MinQuality is the floor every effective quality is clamped to, so
+	// output never degrades into visible artifacts. Zero disables it.
+	MinQuality int
+	// SaveDataQualityReduction is subtracted from the quality of lossy
+	// variants when the client sends Save-Data: on or X-Network-Quality: low,
+	// still subject to MinQuality. Zero disables the adjustment.
+	SaveDataQualityReduction int
+	// MinSourceDimensions rejects uploads smaller than this; profiles can override it
+	MinSourceDimensions Dimensions
+	// MaxDimensions caps output width/height per output format ("jpeg", "png")
+	MaxDimensions map[string]Dimensions
+	// NoUpscale shrinks specs larger than the source to fit within it, so small
+	// uploads such as avatars aren't blurred by upscaling
+	NoUpscale bool
+	// MaxAspectDistortion rejects fill specs that stretch the source's aspect
+	// ratio by more than this factor, e.g. 3 allows 300x100 from a square.
+	// Zero disables the check.
+	MaxAspectDistortion float64
+	// ExtremeAspectRatio is how far, as a factor, the source's aspect ratio
+	// may differ from a cover spec's before ExtremeAspectPolicy applies, e.g.
+	// 2.5 for a 5:2 panorama cropped square. Zero disables it.
+	// The policy is "crop" (the usual centre crop), "pad" (fit inside and
+	// pad to the requested size) or "skip" (don't produce the variant).
+	ExtremeAspectRatio  float64
+	ExtremeAspectPolicy string
+	// Pipeline lists the stages run on the decoded image before resizing, in
+	// order: "trim", "contrast" and "brightness". A stage left out isn't
+	// applied even when a request asks for it.
+	Pipeline []string
+	// DedupSpecs drops specs that resolve to the same size, format, quality,
+	// lossless setting and fit as an earlier one in the same request
+	DedupSpecs bool
+	// VariantSort is the default order of compressed images in responses:
+	// "request", "area_asc" or "area_desc"
+	VariantSort string
+	// StripEXIF turns JPEGs upright from their EXIF orientation before
+	// resizing and stores originals without EXIF, XMP or IPTC metadata
+	StripEXIF bool
+	// ReencodeOriginal stores a re-encoded original at OriginalQuality instead
+	// of the uploaded bytes, trading fidelity for storage cost
+	ReencodeOriginal bool
+	OriginalQuality  int
+	// Workers bounds how many images are processed at once; zero means
+	// unbounded. Up to QueueDepth more uploads wait up to QueueTimeout for a
+	// slot before being rejected with a 503.
+	Workers      int
+	QueueDepth   int
+	QueueTimeout time.Duration
+	// ProcessingTimeout bounds the whole processing of one upload, from
+	// queueing to the last variant; on expiry the images stored so far are
+	// removed. Zero disables it.
+	ProcessingTimeout time.Duration
+	// VariantConcurrency bounds how many compressed sizes of one upload are
+	// produced at once, on top of the Workers limit on whole uploads
+	VariantConcurrency int
+	// UploadAttempts is how often a variant upload is tried before it is
+	// reported as failed; the wait starts at UploadRetryBackoff and doubles
+	UploadAttempts     int
+	UploadRetryBackoff time.Duration
+	// SlowThreshold logs a warning with a stage breakdown for uploads that
+	// take longer to process. Zero disables it.
+	SlowThreshold time.Duration
+	// LazyVariants stores only the original on upload; variants are generated
+	// and cached in S3 the first time they are requested
+	LazyVariants bool
+	// LazyVariantMaxDimension caps the width and height of on-demand
+	// variants, which anyone who can read an image may request
+	LazyVariantMaxDimension int
+	// OriginalCacheControl and VariantCacheControl are the Cache-Control
+	// headers stored with originals and generated variants, e.g.
+	// "public, max-age=31536000, immutable" for variants; empty sets none
+	OriginalCacheControl string
+	VariantCacheControl  string
+	// MoveOverwrite lets moves replace an existing destination when the
+	// request doesn't say either way
+	MoveOverwrite bool
+	// AsyncUploads lets uploads ask for background processing with
+	// ?async=true; finished jobs can be polled for AsyncJobRetention
+	AsyncUploads      bool
+	AsyncJobRetention time.Duration
+	// BackfillRate caps how many originals per second a format backfill converts
+	BackfillRate float64
+	// DirectUploadKey signs the tokens of presigned direct uploads, which are
+	// staged under DirectUploadPrefix and must be completed within
+	// DirectUploadExpiry. Empty disables direct uploads.
+	DirectUploadKey    string
+	DirectUploadPrefix string
+	DirectUploadExpiry time.Duration
+	// ReceiptKey signs an HMAC receipt into every upload response. Empty disables receipts.
+	ReceiptKey string
+	// KeyNaming makes object keys unique: "timestamp", "uuid", "suffix"
+	// (name.jpg, then name-1.jpg...) or "content" (<sha256>.jpg, with
+	// variants as <sha256>_600x400.jpg); suffix naming gives up after
+	// KeySuffixMaxAttempts collisions
+	KeyNaming            string
+	KeySuffixMaxAttempts int
+	// NameCollision checks for an existing original with the same upload name
+	// under the target prefix: "" skips the check, "warn" adds a response
+	// warning and "error" rejects the upload
+	NameCollision string
+	// DownloadFilenameTemplate builds the suggested filename for saving an image
+	// from {name} (the sanitized upload name), {width}, {height} and {ext}
+	DownloadFilenameTemplate string
+	// DatePartition adds a date segment to keys, as a Go time layout such as
+	// "2006/01/02"; empty disables it. With DatePartitionFromEXIF the date is
+	// the EXIF DateTimeOriginal when present instead of the upload time.
+	DatePartition         string
+	DatePartitionFromEXIF bool
+	// Environment is the top-level key segment, e.g. "prod" or "staging", so
+	// environments can share a bucket; keys outside it are treated as missing
+	// and listings stay inside it. Empty disables the namespacing.
+	Environment string
+	// KeyPrefix is prepended to every object key after the environment, e.g. "uploads"
+	KeyPrefix string
+	// FormatPrefixes maps an output format to a key prefix, e.g. "webp" to "webp/"
+	FormatPrefixes map[string]string
+	// Profiles are named processing defaults selected with the X-Image-Profile header
+	Profiles map[string]Profile
+}
+
+// Dimensions is a width/height pair in pixels; zero means unbounded
+type Dimensions struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Profile holds one client app's processing defaults; request fields still win
+type Profile struct {
+	Resize        string                  `json:"resize"`         // Resize algorithm, e.g. "lanczos3" or "bilinear"
+	Format        string                  `json:"format"`         // Default output format
+	Quality       int                     `json:"quality"`        // Lossy quality, replacing IMAGE_QUALITY
+	Presets       map[string][]Dimensions `json:"presets"`        // Named size sets, chosen with the preset form field
+	DefaultPreset string                  `json:"default_preset"` // Sizes used when a request sends no compress_sizes or preset
+	MinSource     Dimensions              `json:"min_source"`     // Minimum upload size, replacing IMAGE_MIN_SOURCE_DIMENSIONS
+}
+
+// CDNConfig holds cache invalidation settings for deletes and overwrites
+type CDNConfig struct {
+	Provider       string // "none", "cloudfront" or "webhook"
+	DistributionID string // CloudFront distribution to invalidate
+	WebhookURL     string // Receives a POST with the affected keys
+}
+
+// New loads the configuration from environment variables
+func New() *Config {
+	return &Config{
+		App: AppConfig{
+			Port:                   getEnv("PORT", "8080"),
+			MaxUploadBytes:         getEnvInt64("MAX_UPLOAD_BYTES", 32<<20),
+			UploadSoftLimitBytes:   getEnvInt64("UPLOAD_SOFT_LIMIT_BYTES", 0),
+			MaxBatchFiles:          getEnvInt("UPLOAD_MAX_BATCH_FILES", 1),
+			UploadRateLimit:        getEnvFloat("UPLOAD_RATE_LIMIT", 0),
+			UploadRateBurst:        getEnvInt("UPLOAD_RATE_BURST", 10),
+			TrustForwardedFor:      getEnvBool("TRUST_FORWARDED_FOR", false),
+			ErrorFormat:            getEnv("ERROR_FORMAT", "default"),
+			ProblemTypeBaseURL:     getEnv("PROBLEM_TYPE_BASE_URL", "/problems"),
+			AllowDebug:             getEnvBool("ALLOW_DEBUG", false),
+			AllowProcessOnly:       getEnvBool("ALLOW_PROCESS_ONLY", false),
+			AllowAllEnvironments:   getEnvBool("ALLOW_ALL_ENVIRONMENTS_LISTING", false),
+			VariantsHeader:         getEnvBool("VARIANTS_HEADER", false),
+			VariantsHeaderMaxBytes: getEnvInt("VARIANTS_HEADER_MAX_BYTES", 4096),
+			TLSCertFile:            getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:             getEnv("TLS_KEY_FILE", ""),
+			ShutdownTimeout:        getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+			LogLevel:               getEnv("LOG_LEVEL", "info"),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS", ""),
+			AllowedMethods: getEnvList("CORS_ALLOWED_METHODS", "GET,POST,DELETE"),
+			AllowedHeaders: getEnvList("CORS_ALLOWED_HEADERS", "Authorization,Content-Type,Range,Save-Data,X-API-Key,X-Collection,X-Content-SHA256,X-Image-Profile,X-Image-Quality,X-Network-Quality,X-Request-ID"),
+			ExposedHeaders: getEnvList("CORS_EXPOSED_HEADERS", "Content-Range,ETag,Location,Retry-After,X-Failed-Size,X-Image-Warning,X-List-Warning,X-Next-Token,X-Request-ID,X-Upload-Warning,X-Variants,X-Variants-Omitted"),
+			MaxAge:         getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+		},
+		Storage: StorageConfig{
+			Backend:      getEnv("STORAGE_BACKEND", "s3"),
+			LocalDir:     getEnv("LOCAL_STORAGE_DIR", "./data"),
+			LocalBaseURL: getEnv("LOCAL_STORAGE_URL", "http://localhost:8080/files"),
+		},
+		S3: S3Config{
+			BucketName:         getEnv("S3_BUCKET_NAME", ""),
+			Region:             getEnv("AWS_REGION", "us-east-1"),
+			Endpoint:           getEnv("S3_ENDPOINT", ""),
+			AccessKeyID:        getEnv("AWS_ACCESS_KEY_ID", ""),
+			SecretAccessKey:    getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			PresignExpiry:      getEnvDuration("S3_PRESIGN_EXPIRY", 15*time.Minute),
+			UsePresignedURLs:   getEnvBool("S3_USE_PRESIGNED_URLS", false),
+			StorageClass:       getEnv("S3_STORAGE_CLASS", ""),
+			MultipartEnabled:   getEnvBool("S3_MULTIPART_ENABLED", true),
+			MultipartThreshold: getEnvInt64("S3_MULTIPART_THRESHOLD", 5<<30),
+			MultipartPartSize:  getEnvInt64("S3_MULTIPART_PART_SIZE", 64<<20),
+			AutoDetectRegion:   getEnvBool("S3_AUTO_DETECT_REGION", false),
+			MinTLSVersion:      getEnv("S3_MIN_TLS_VERSION", "1.2"),
+			ExistenceCacheTTL:  getEnvDuration("S3_EXISTENCE_CACHE_TTL", 0),
+			ExistenceCacheSize: getEnvInt("S3_EXISTENCE_CACHE_SIZE", 10000),
+			OperationTimeout:   getEnvDuration("S3_OPERATION_TIMEOUT", 30*time.Second),
+		},
+		Auth: AuthConfig{
+			Mode:        getEnv("AUTH_MODE", "none"),
+			APIKeys:     getEnvList("API_KEYS", ""),
+			JWTSecret:   getEnv("JWT_SECRET", ""),
+			JWKSURL:     getEnv("JWT_JWKS_URL", ""),
+			JWTAudience: getEnv("JWT_AUDIENCE", ""),
+			JWTIssuer:   getEnv("JWT_ISSUER", ""),
+			// Unauthenticated admin routes must be asked for explicitly
+			AdminWithoutAuth:     getEnvBool("ADMIN_ROUTES_WITHOUT_AUTH", false),
+			DebugVarsWithoutAuth: getEnvBool("DEBUG_VARS_WITHOUT_AUTH", false),
+			MetricsWithoutAuth:   getEnvBool("METRICS_LITE_WITHOUT_AUTH", false),
+		},
+		Image: ImageConfig{
+			Quality:                  getEnvInt("IMAGE_QUALITY", 85),
+			ResizeAlgorithm:          getEnv("IMAGE_RESIZE_ALGORITHM", "lanczos3"),
+			PNGCompression:           getEnv("IMAGE_PNG_COMPRESSION", "default"),
+			MinQuality:               getEnvInt("IMAGE_MIN_QUALITY", 0),
+			SaveDataQualityReduction: getEnvInt("IMAGE_SAVE_DATA_QUALITY_REDUCTION", 0),
+			MaxDimensions:            getEnvDimensions("IMAGE_MAX_DIMENSIONS"),
+			MinSourceDimensions:      getEnvSize("IMAGE_MIN_SOURCE_DIMENSIONS"),
+			KeyNaming:                getEnv("KEY_NAMING", "timestamp"),
+			KeySuffixMaxAttempts:     getEnvInt("KEY_SUFFIX_MAX_ATTEMPTS", 100),
+			NameCollision:            getEnv("NAME_COLLISION_CHECK", ""),
+			Environment:              getEnv("ENVIRONMENT", ""),
+			KeyPrefix:                getEnv("KEY_PREFIX", ""),
+			DatePartition:            getEnv("KEY_DATE_PARTITION", ""),
+			DatePartitionFromEXIF:    getEnvBool("KEY_DATE_PARTITION_EXIF", false),
+			DownloadFilenameTemplate: getEnv("IMAGE_DOWNLOAD_FILENAME_TEMPLATE", "{name}-{width}x{height}{ext}"),
+			FormatPrefixes:           getEnvMap("IMAGE_FORMAT_PREFIXES"),
+			Profiles:                 getEnvProfiles("IMAGE_PROFILES"),
+			NoUpscale:                getEnvBool("IMAGE_NO_UPSCALE", false),
+			VariantSort:              getEnv("IMAGE_VARIANT_SORT", "request"),
+			DedupSpecs:               getEnvBool("IMAGE_DEDUP_SPECS", true),
+			Pipeline:                 getEnvList("IMAGE_PIPELINE", "trim,contrast,brightness"),
+			MaxAspectDistortion:      getEnvFloat("IMAGE_MAX_ASPECT_DISTORTION", 3),
+			ExtremeAspectRatio:       getEnvFloat("IMAGE_EXTREME_ASPECT_RATIO", 0),
+			ExtremeAspectPolicy:      getEnv("IMAGE_EXTREME_ASPECT_POLICY", "crop"),
+			ReencodeOriginal:         getEnvBool("IMAGE_REENCODE_ORIGINAL", false),
+			StripEXIF:                getEnvBool("IMAGE_STRIP_EXIF", true),
+			OriginalQuality:          getEnvInt("IMAGE_ORIGINAL_QUALITY", 90),
+			SlowThreshold:            getEnvDuration("IMAGE_SLOW_THRESHOLD", 0),
+			UploadAttempts:           getEnvInt("IMAGE_UPLOAD_ATTEMPTS", 3),
+			UploadRetryBackoff:       getEnvDuration("IMAGE_UPLOAD_RETRY_BACKOFF", 200*time.Millisecond),
+			Workers:                  getEnvInt("IMAGE_WORKERS", 0),
+			QueueDepth:               getEnvInt("IMAGE_QUEUE_DEPTH", 64),
+			QueueTimeout:             getEnvDuration("IMAGE_QUEUE_TIMEOUT", 30*time.Second),
+			ProcessingTimeout:        getEnvDuration("IMAGE_PROCESSING_TIMEOUT", 2*time.Minute),
+			VariantConcurrency:       getEnvInt("IMAGE_VARIANT_CONCURRENCY", runtime.NumCPU()),
+			LazyVariants:             getEnvBool("IMAGE_LAZY_VARIANTS", false),
+			LazyVariantMaxDimension:  getEnvInt("IMAGE_LAZY_VARIANT_MAX_DIMENSION", 4096),
+			OriginalCacheControl:     getEnv("IMAGE_ORIGINAL_CACHE_CONTROL", ""),
+			VariantCacheControl:      getEnv("IMAGE_VARIANT_CACHE_CONTROL", ""),
+			BackfillRate:             getEnvFloat("IMAGE_BACKFILL_RATE", 5),
+			AsyncUploads:             getEnvBool("IMAGE_ASYNC_UPLOADS", false),
+			AsyncJobRetention:        getEnvDuration("IMAGE_ASYNC_JOB_RETENTION", time.Hour),
+			MoveOverwrite:            getEnvBool("IMAGE_MOVE_OVERWRITE", false),
+			ReceiptKey:               getEnv("RECEIPT_SIGNING_KEY", ""),
+			DirectUploadKey:          getEnv("DIRECT_UPLOAD_SIGNING_KEY", ""),
+			DirectUploadPrefix:       getEnv("DIRECT_UPLOAD_PREFIX", "incoming"),
+			DirectUploadExpiry:       getEnvDuration("DIRECT_UPLOAD_EXPIRY", 15*time.Minute),
+		},
+		CDN: CDNConfig{
+			Provider:       getEnv("CDN_PROVIDER", "none"),
+			DistributionID: getEnv("CDN_DISTRIBUTION_ID", ""),
+			WebhookURL:     getEnv("CDN_WEBHOOK_URL", ""),
+		},
+	}
+}
+
+// Helper function to read a string environment variable with a fallback
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// Helper function to read an int64 environment variable with a fallback
+func getEnvInt64(key string, fallback int64) int64 {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %d: %v", key, fallback, err)
+		return fallback
+	}
+
+	return parsed
+}
+
+// Helper function to read a boolean environment variable with a fallback
+func getEnvBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %t: %v", key, fallback, err)
+		return fallback
+	}
+
+	return parsed
+}
+
+// Helper function to read a duration environment variable ("90s", "15m") with a fallback
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %s: %v", key, fallback, err)
+		return fallback
+	}
+
+	return parsed
+}
+
+// Helper function to read a float environment variable with a fallback
+func getEnvFloat(key string, fallback float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid value for %s, using default %g: %v", key, fallback, err)
+		return fallback
+	}
+
+	return parsed
+}
+
+// Helper function to read an int environment variable with a fallback
+func getEnvInt(key string, fallback int) int {
+	return int(getEnvInt64(key, int64(fallback)))
+}
+
+// Helper function to read a comma-separated list, dropping empty entries
+func getEnvList(key, fallback string) []string {
+	var entries []string
+	for _, entry := range strings.Split(getEnv(key, fallback), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Helper function to read a comma-separated list of key=value pairs
+func getEnvMap(key string) map[string]string {
+	entries := make(map[string]string)
+	value := getEnv(key, "")
+	if value == "" {
+		return entries
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		k, v, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || k == "" {
+			log.Printf("Ignoring invalid %s entry %q, expected key=value", key, entry)
+			continue
+		}
+		entries[strings.ToLower(k)] = v
+	}
+
+	return entries
+}
+
+// Helper function to read a single WIDTHxHEIGHT size such as "800x800"
+func getEnvSize(key string) Dimensions {
+	var d Dimensions
+	value := getEnv(key, "")
+	if value == "" {
+		return d
+	}
+
+	if _, err := fmt.Sscanf(value, "%dx%d", &d.Width, &d.Height); err != nil {
+		log.Printf("Ignoring invalid %s, expected WIDTHxHEIGHT", key)
+		return Dimensions{}
+	}
+
+	return d
+}
+
+// Helper function to read per-format dimension limits such as "jpeg=8000x8000,png=4000x4000"
+func getEnvDimensions(key string) map[string]Dimensions {
+	limits := make(map[string]Dimensions)
+	for format, dims := range getEnvMap(key) {
+		var d Dimensions
+		if _, err := fmt.Sscanf(dims, "%dx%d", &d.Width, &d.Height); err != nil {
+			log.Printf("Ignoring invalid %s entry for %s, expected WIDTHxHEIGHT", key, format)
+			continue
+		}
+		limits[format] = d
+	}
+
+	return limits
+}
+
+// Helper function to read processing profiles from a JSON object keyed by
+// profile name, e.g. {"mobile":{"format":"webp","quality":70}}
+func getEnvProfiles(key string) map[string]Profile {
+	profiles := make(map[string]Profile)
+	value := getEnv(key, "")
+	if value == "" {
+		return profiles
+	}
+
+	if err := json.Unmarshal([]byte(value), &profiles); err != nil {
+		log.Printf("Ignoring invalid %s: %v", key, err)
+		return make(map[string]Profile)
+	}
+
+	return profiles
+}
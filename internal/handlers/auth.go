@@ -0,0 +1,301 @@
+// internal/handlers/auth.go
+package handlers
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"image-upload-server/internal/config"
+)
+
+// Supported authentication modes
+const (
+	AuthModeNone   = "none"
+	AuthModeJWT    = "jwt"
+	AuthModeAPIKey = "apikey"
+)
+
+// jwksRefreshInterval bounds how often an unknown key id triggers a JWKS
+// refetch, successful or not
+const jwksRefreshInterval = time.Minute
+
+// identityKey is the context key under which the caller's identity is stored
+type identityKey struct{}
+
+// Authenticator validates credentials on incoming API requests
+type Authenticator struct {
+	cfg    config.AuthConfig
+	parser *jwt.Parser
+	jwks   *jwksCache
+	// apiKeys holds the SHA-256 of each accepted API key, so every
+	// comparison is over the same length
+	apiKeys [][sha256.Size]byte
+}
+
+// Enabled reports whether requests are authenticated, i.e. the mode isn't "none"
+func (a *Authenticator) Enabled() bool {
+	return a.cfg.Mode != "" && a.cfg.Mode != AuthModeNone
+}
+
+// NewAuthenticator creates an authenticator for the configured mode
+func NewAuthenticator(cfg config.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{cfg: cfg}
+
+	switch cfg.Mode {
+	case "", AuthModeNone:
+		return a, nil
+	case AuthModeAPIKey:
+		if len(cfg.APIKeys) == 0 {
+			return nil, errors.New("apikey auth requires API_KEYS")
+		}
+		for _, key := range cfg.APIKeys {
+			a.apiKeys = append(a.apiKeys, sha256.Sum256([]byte(key)))
+		}
+		return a, nil
+	case AuthModeJWT:
+		if cfg.JWTSecret == "" && cfg.JWKSURL == "" {
+			return nil, errors.New("jwt auth requires JWT_SECRET or JWT_JWKS_URL")
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", cfg.Mode)
+	}
+
+	opts := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if cfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.JWTAudience))
+	}
+	if cfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWKSURL != "" {
+		opts = append(opts, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}))
+		a.jwks = &jwksCache{
+			url:    cfg.JWKSURL,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+		if err := a.jwks.refresh(); err != nil {
+			return nil, fmt.Errorf("failed to load JWKS: %w", err)
+		}
+	} else {
+		opts = append(opts, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	}
+	a.parser = jwt.NewParser(opts...)
+
+	return a, nil
+}
+
+// Middleware rejects requests without valid credentials with a 401
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	if a.apiKeys != nil {
+		return a.apiKeyMiddleware(next)
+	}
+	if a.parser == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Missing bearer token")
+			return
+		}
+
+		parsed, err := a.parser.Parse(token, a.keyFunc)
+		if err != nil {
+			respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid token: "+err.Error())
+			return
+		}
+
+		subject, err := parsed.Claims.GetSubject()
+		if err != nil || subject == "" {
+			respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid token: missing subject")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), identityKey{}, subject)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// apiKeyMiddleware accepts requests carrying one of the configured keys,
+// in an X-API-Key header or as a bearer token. The caller's identity is
+// derived from the key it used, so each key gets its own tenant namespace.
+func (a *Authenticator) apiKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			key, _ = bearerToken(r)
+		}
+		if key == "" {
+			respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Missing API key")
+			return
+		}
+		sum, ok := a.validAPIKey(key)
+		if !ok {
+			respondWithError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, apiKeyIdentity(sum))))
+	})
+}
+
+// Helper function to check a key against every configured key in constant
+// time, so neither the match nor its position leaks through timing. It
+// returns the key's SHA-256, which identifies the caller from then on.
+func (a *Authenticator) validAPIKey(key string) ([sha256.Size]byte, bool) {
+	sum := sha256.Sum256([]byte(key))
+	match := 0
+	for _, accepted := range a.apiKeys {
+		match |= subtle.ConstantTimeCompare(sum[:], accepted[:])
+	}
+	return sum, match == 1
+}
+
+// Helper function to derive a caller's identity from the SHA-256 of its API
+// key, e.g. "apikey-3f9a1c2b5d7e"; truncated, it can't be (nor needs to be)
+// turned back into the key, yet stays stable for as long as the key is
+func apiKeyIdentity(sum [sha256.Size]byte) string {
+	return "apikey-" + hex.EncodeToString(sum[:6])
+}
+
+// Helper function to get the authenticated identity, empty when auth is disabled
+func identityFromRequest(r *http.Request) string {
+	identity, _ := r.Context().Value(identityKey{}).(string)
+	return identity
+}
+
+// keyFunc resolves the verification key for a token
+func (a *Authenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	if a.jwks == nil {
+		return []byte(a.cfg.JWTSecret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	return a.jwks.key(kid)
+}
+
+// Helper function to extract the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// jwksCache holds the RSA public keys published at a JWKS URL
+type jwksCache struct {
+	url    string
+	client *http.Client
+	mu     sync.RWMutex
+	keys   map[string]*rsa.PublicKey
+	// attemptedAt is when the last fetch started, whether or not it succeeded
+	attemptedAt time.Time
+}
+
+// key returns the public key for a key id, refetching the set once if unknown
+func (c *jwksCache) key(kid string) (*rsa.PublicKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	c.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+	if c.claimRefresh() {
+		if err := c.refresh(); err != nil {
+			return nil, fmt.Errorf("unknown signing key %q and refreshing the key set failed: %w", kid, err)
+		}
+		c.mu.RLock()
+		key, ok = c.keys[kid]
+		c.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// claimRefresh reports whether the caller may refetch the key set, at most
+// once per jwksRefreshInterval across all requests. Failed attempts count
+// too, so tokens with an unknown key id or an unreachable JWKS URL can't
+// make every request refetch.
+func (c *jwksCache) claimRefresh() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.attemptedAt) <= jwksRefreshInterval {
+		return false
+	}
+	c.attemptedAt = time.Now()
+	return true
+}
+
+// refresh downloads and parses the key set
+func (c *jwksCache) refresh() error {
+	c.mu.Lock()
+	c.attemptedAt = time.Now()
+	c.mu.Unlock()
+
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected JWKS status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("invalid JWKS document: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,106 @@
+// internal/handlers/auth_test.go
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"image-upload-server/internal/config"
+)
+
+func TestAPIKeyMiddlewareSetsIdentity(t *testing.T) {
+	auth, err := NewAuthenticator(config.AuthConfig{Mode: AuthModeAPIKey, APIKeys: []string{"first-key", "second-key"}})
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	var identity string
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = identityFromRequest(r)
+	}))
+	identityFor := func(header, value string) (string, int) {
+		identity = ""
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/images", nil)
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return identity, rec.Code
+	}
+
+	first, code := identityFor("X-API-Key", "first-key")
+	if code != http.StatusOK || !strings.HasPrefix(first, "apikey-") {
+		t.Fatalf("first key: status %d, identity %q", code, first)
+	}
+	if again, _ := identityFor("Authorization", "Bearer first-key"); again != first {
+		t.Errorf("same key as a bearer token got identity %q, want %q", again, first)
+	}
+	if second, _ := identityFor("X-API-Key", "second-key"); second == first || second == "" {
+		t.Errorf("second key got identity %q, first %q; want distinct identities", second, first)
+	}
+	if strings.Contains(first, "first-key") {
+		t.Errorf("identity %q exposes the key", first)
+	}
+	if _, code := identityFor("X-API-Key", "unknown"); code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestJWKSRefreshBacksOff(t *testing.T) {
+	var fetches atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"keys": []}`))
+	}))
+	defer server.Close()
+
+	auth, err := NewAuthenticator(config.AuthConfig{Mode: AuthModeJWT, JWKSURL: server.URL})
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Fatalf("%d fetches at startup, want 1", got)
+	}
+
+	// Right after a fetch, unknown key ids are rejected without refetching
+	lookupUnknown := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := auth.jwks.key("unknown"); err == nil {
+					t.Error("unknown key id accepted")
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	lookupUnknown()
+	if got := fetches.Load(); got != 1 {
+		t.Fatalf("%d fetches after lookups within the interval, want 1", got)
+	}
+
+	// Once the interval passed, a burst refetches once; a failure backs off as well
+	failing.Store(true)
+	for _, want := range []int32{2, 3} {
+		auth.jwks.mu.Lock()
+		auth.jwks.attemptedAt = time.Now().Add(-2 * jwksRefreshInterval)
+		auth.jwks.mu.Unlock()
+
+		lookupUnknown()
+		lookupUnknown()
+		if got := fetches.Load(); got != want {
+			t.Fatalf("%d fetches after a burst past the interval, want %d", got, want)
+		}
+	}
+}
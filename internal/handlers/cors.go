@@ -0,0 +1,100 @@
+// internal/handlers/cors.go
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"image-upload-server/internal/config"
+)
+
+// CORS returns middleware that lets browsers call the API from the
+// configured origins. Preflights are answered here, before routing and
+// authentication, as browsers send them without credentials. Wrap the whole
+// router so error responses carry the headers too and scripts can read them.
+func CORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	anyHeader := slices.Contains(cfg.AllowedHeaders, "*")
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			if !anyOrigin {
+				// The response depends on the origin, so caches must not share it
+				header.Add("Vary", "Origin")
+			}
+			if !anyOrigin && !allowedOrigin(cfg.AllowedOrigins, origin) {
+				if preflight {
+					respondWithError(w, r, http.StatusForbidden, codeForbidden, "Origin "+origin+" is not allowed")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if !preflight {
+				if exposed != "" {
+					header.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", methods)
+			if anyHeader {
+				if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					header.Set("Access-Control-Allow-Headers", requested)
+				}
+			} else if headers != "" {
+				header.Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// Helper function to match an origin against the allowed list, where an
+// entry such as "https://*.example.com" matches any subdomain
+func allowedOrigin(allowed []string, origin string) bool {
+	for _, entry := range allowed {
+		if strings.EqualFold(entry, origin) {
+			return true
+		}
+		scheme, domain, found := strings.Cut(entry, "://*.")
+		if !found {
+			continue
+		}
+		host, ok := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+		if ok && strings.HasSuffix(host, "."+strings.ToLower(domain)) {
+			return true
+		}
+	}
+	return false
+}
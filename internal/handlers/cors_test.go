@@ -0,0 +1,58 @@
+// internal/handlers/cors_test.go
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"image-upload-server/internal/config"
+)
+
+// Helper function to wrap a no-op handler in the default CORS settings for one origin
+func defaultCORS() http.Handler {
+	cfg := config.New().CORS
+	cfg.AllowedOrigins = []string{"https://app.example.com"}
+	return CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+// Helper function to split a comma-separated header value
+func headerList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		list = append(list, strings.TrimSpace(item))
+	}
+	return list
+}
+
+func TestCORSDefaultAllowedHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/upload", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec := httptest.NewRecorder()
+	defaultCORS().ServeHTTP(rec, req)
+
+	allowed := headerList(rec.Header().Get("Access-Control-Allow-Headers"))
+	for _, header := range []string{"Authorization", "X-API-Key"} {
+		if !slices.Contains(allowed, header) {
+			t.Errorf("preflight allows %v, missing %s", allowed, header)
+		}
+	}
+}
+
+func TestCORSDefaultExposedHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	defaultCORS().ServeHTTP(rec, req)
+
+	exposed := headerList(rec.Header().Get("Access-Control-Expose-Headers"))
+	// Asynchronous uploads return their job URL only in Location
+	for _, header := range []string{"Location", "X-Request-ID"} {
+		if !slices.Contains(exposed, header) {
+			t.Errorf("responses expose %v, missing %s", exposed, header)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// internal/handlers/direct.go
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"image-upload-server/internal/models"
+	"image-upload-server/internal/repository"
+	"image-upload-server/internal/service"
+)
+
+// PresignUpload handles direct upload requests
+// @Summary Get a presigned upload URL
+// @Description Issue a presigned PUT to upload a file straight to S3, and a token to complete it with. PUT exactly size bytes to upload_url with the returned headers, then call POST /complete with the token before expires_at to process the file.
+// @Tags images
+// @Accept json
+// @Produce json
+// @Param request body models.DirectUploadRequest true "File to upload"
+// @Success 200 {object} models.DirectUploadResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 501 {object} models.ErrorResponse
+// @Router /uploads/presign [post]
+func (h *ImageHandler) PresignUpload(w http.ResponseWriter, r *http.Request) {
+	var request models.DirectUploadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormValueBytes)).Decode(&request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid upload request: "+err.Error())
+		return
+	}
+
+	if !supportedExtension(request.Filename) {
+		respondWithError(w, r, http.StatusBadRequest, codeUnsupportedFileType, "Unsupported file type. Only JPG, PNG, WebP and GIF are supported")
+		return
+	}
+	if !supportedContentType(request.ContentType) {
+		respondWithError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedFileType, "content_type must be image/jpeg, image/png, image/webp or image/gif")
+		return
+	}
+	if request.Size <= 0 {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "size must be the file size in bytes")
+		return
+	}
+	if request.Size > h.cfg.MaxUploadBytes {
+		reqErr := h.tooLarge()
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+
+	response, err := h.service.PresignDirectUpload(r.Context(), identityFromRequest(r), request)
+	if err != nil {
+		if errors.Is(err, service.ErrDirectUploadDisabled) {
+			respondWithError(w, r, http.StatusForbidden, codeForbidden, "Direct uploads are disabled on this server")
+			return
+		}
+		if errors.Is(err, repository.ErrNotSupported) {
+			respondWithError(w, r, http.StatusNotImplemented, codeNotSupported, "Direct uploads are not available with this storage backend")
+			return
+		}
+		if h.respondContextError(w, r, err) {
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// CompleteUpload handles completion of direct uploads
+// @Summary Process a direct upload
+// @Description Process a file PUT with a presigned upload URL, like POST /upload. The staged file is removed once processed, so each token completes one upload; after a failure such as an invalid spec it can be retried until the token expires.
+// @Tags images
+// @Accept json
+// @Produce json
+// @Param X-Image-Profile header string false "Named processing profile supplying default format, quality, resize algorithm and presets"
+// @Param X-Collection header string false "Logical collection stored as a key segment after the caller's namespace"
+// @Param X-Image-Quality header int false "Default JPEG and WebP quality, 1-100, for specs without their own; an invalid value is ignored with a warning"
+// @Param Save-Data header string false "Client hint; on lowers the quality of lossy images by the server's Save-Data reduction" Enums(on)
+// @Param X-Network-Quality header string false "Set to low for the same reduced quality as Save-Data: on" Enums(low)
+// @Param X-Content-SHA256 header string false "SHA-256 of the file, hex or base64; completion is rejected with 400 CHECKSUM_MISMATCH if the staged bytes differ"
+// @Param request body models.CompleteUploadRequest true "Token and processing options"
+// @Success 200 {object} models.UploadResponse
+// @Header 200 {string} X-Variants "Comma-separated WxH:url per compressed image, when enabled on the server"
+// @Header 200 {int} X-Variants-Omitted "Number of compressed images left out of X-Variants to keep it within the size limit"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Header 429 {string} Retry-After "Seconds until the client may upload again"
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /complete [post]
+func (h *ImageHandler) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	w = recorder
+	var size int64
+	defer func() { h.metrics.recordUpload(recorder.status, size) }()
+
+	var request models.CompleteUploadRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormValueBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid completion request: "+err.Error())
+		return
+	}
+
+	profile := r.Header.Get("X-Image-Profile")
+	if len(request.CompressSizes) == 0 && profile == "" && request.Preset == "" {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Missing compress_sizes parameter")
+		return
+	}
+	collection := r.Header.Get("X-Collection")
+	if !validCollection(collection) {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid X-Collection: use up to 64 letters, digits, '.', '-' or '_'")
+		return
+	}
+	if !validFolder(request.Folder) {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid folder: must not contain '.' or '..' segments, backslashes or control characters")
+		return
+	}
+
+	tenant := identityFromRequest(r)
+	upload, err := h.service.ClaimDirectUpload(r.Context(), tenant, request.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDirectUploadDisabled):
+			respondWithError(w, r, http.StatusForbidden, codeForbidden, "Direct uploads are disabled on this server")
+		case errors.Is(err, service.ErrInvalidUploadToken):
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidUploadToken, err.Error())
+		case errors.Is(err, service.ErrImageNotFound):
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "No file was uploaded for this token")
+		case errors.Is(err, service.ErrUploadMismatch):
+			respondWithError(w, r, http.StatusConflict, codeUploadMismatch, err.Error())
+		default:
+			if !h.respondContextError(w, r, err) {
+				respondWithError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+			}
+		}
+		return
+	}
+
+	size = int64(len(upload.Bytes))
+	if size > h.cfg.MaxUploadBytes {
+		reqErr := h.tooLarge()
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+	if reqErr := checkImageContent(upload.Bytes); reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+	digest, reqErr := verifyChecksum(r, upload.Bytes)
+	if reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+
+	var warnings []string
+	quality, qualityWarning := requestQuality(r)
+	if qualityWarning != "" {
+		warnings = append(warnings, qualityWarning)
+	}
+	pngCompression, pngWarning := pngCompressionOption(request.PNGCompression)
+	if pngWarning != "" {
+		warnings = append(warnings, pngWarning)
+	}
+	// Also honoured as a query parameter, as on a multipart upload
+	histogram := request.Histogram || r.URL.Query().Get("histogram") == "true"
+	trimTolerance := float64(service.DefaultTrimTolerance)
+	if request.TrimTolerance != nil {
+		trimTolerance = *request.TrimTolerance
+	}
+
+	// Same options as a multipart upload; the service validates the ranges
+	// and storage classes
+	opts := service.UploadOptions{
+		Tenant:              tenant,
+		ContentSHA256:       digest,
+		Collection:          collection,
+		Folder:              request.Folder,
+		Format:              request.Format,
+		Quality:             quality,
+		SaveData:            saveData(r),
+		Lossless:            request.Lossless,
+		PNGCompression:      pngCompression,
+		Profile:             profile,
+		Preset:              request.Preset,
+		Histogram:           histogram,
+		Sort:                request.Sort,
+		StorageClass:        request.StorageClass,
+		VariantStorageClass: request.VariantStorageClass,
+		Brightness:          request.Brightness,
+		Contrast:            request.Contrast,
+		Trim:                request.Trim,
+		TrimTolerance:       trimTolerance,
+	}
+	response, err := h.service.ProcessAndUploadImage(r.Context(), upload.Bytes, upload.Filename, request.CompressSizes, opts)
+	if err != nil {
+		h.respondUploadError(w, r, err)
+		return
+	}
+	response.Warnings = append(response.Warnings, warnings...)
+	h.setVariantsHeader(w, response)
+
+	// The images are stored; a leftover staged copy only costs storage
+	if err := h.service.FinishDirectUpload(r.Context(), upload); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to remove staged upload", "key", upload.Key, "error", err)
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
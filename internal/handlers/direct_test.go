@@ -0,0 +1,129 @@
+// internal/handlers/direct_test.go
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"image-upload-server/internal/config"
+	"image-upload-server/internal/models"
+	"image-upload-server/internal/repository"
+	"image-upload-server/internal/repository/s3test"
+)
+
+func TestCompleteUploadForwardsOptions(t *testing.T) {
+	// A 200x150 black rectangle on a white 400x300 background
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(100, 75, 300, 225), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	var file bytes.Buffer
+	if err := png.Encode(&file, img); err != nil {
+		t.Fatalf("encoding test image: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		options       string // JSON fields added to the completion request
+		wantStatus    int
+		wantWidth     int // Of the stored original
+		wantWarning   string
+		wantErrorCode string
+		wantHistogram bool
+	}{
+		{name: "no options", wantStatus: http.StatusOK, wantWidth: 400},
+		{name: "trim", options: `"trim": true, "trim_tolerance": 5`, wantStatus: http.StatusOK, wantWidth: 200},
+		{name: "invalid brightness", options: `"brightness": 500`, wantStatus: http.StatusBadRequest, wantErrorCode: codeInvalidSpec},
+		{name: "invalid trim tolerance", options: `"trim": true, "trim_tolerance": -1`, wantStatus: http.StatusBadRequest, wantErrorCode: codeInvalidSpec},
+		{name: "unknown png compression", options: `"png_compression": "fastest"`, wantStatus: http.StatusOK, wantWidth: 400, wantWarning: "png_compression"},
+		{name: "lossless", options: `"lossless": true, "contrast": 10`, wantStatus: http.StatusOK, wantWidth: 400},
+		{name: "histogram", options: `"histogram": true`, wantStatus: http.StatusOK, wantWidth: 400, wantHistogram: true},
+		{name: "storage classes", options: `"storage_class": "GLACIER", "variant_storage_class": "STANDARD_IA"`, wantStatus: http.StatusOK, wantWidth: 400},
+		{name: "invalid storage class", options: `"storage_class": "COLD"`, wantStatus: http.StatusBadRequest, wantErrorCode: codeInvalidSpec},
+		{name: "invalid variant storage class", options: `"variant_storage_class": "COLD"`, wantStatus: http.StatusBadRequest, wantErrorCode: codeInvalidSpec},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := s3test.New()
+			s3cfg := config.New().S3
+			s3cfg.BucketName = "test-bucket"
+			presigner := s3.NewPresignClient(s3.New(s3.Options{
+				Region:       "us-east-1",
+				BaseEndpoint: aws.String("http://s3.test"),
+				UsePathStyle: true,
+				Credentials:  credentials.NewStaticCredentialsProvider("test-key-id", "test-secret", ""),
+			}))
+			repo := repository.NewS3RepositoryWithClient(fake, presigner, s3cfg)
+			h := newTestHandler(t, repo, func(cfg *config.Config) {
+				cfg.Image.DirectUploadKey = "test-signing-key"
+				cfg.Image.UploadAttempts = 1
+			})
+
+			// Presign, then stage the file where the client's PUT would put it
+			rec := httptest.NewRecorder()
+			h.PresignUpload(rec, httptest.NewRequest(http.MethodPost, "/api/v1/uploads/presign",
+				strings.NewReader(`{"filename": "photo.png", "content_type": "image/png", "size": `+strconv.Itoa(file.Len())+`}`)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("presign: status %d: %s", rec.Code, rec.Body)
+			}
+			var presigned models.DirectUploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &presigned); err != nil {
+				t.Fatalf("decoding presign response: %v", err)
+			}
+			uploadURL, err := url.Parse(presigned.UploadURL)
+			if err != nil {
+				t.Fatalf("parsing upload URL: %v", err)
+			}
+			stagedKey := strings.TrimPrefix(uploadURL.Path, "/test-bucket/")
+			if _, err := repo.UploadFile(context.Background(), file.Bytes(), stagedKey, "image/png", repository.PutOptions{}); err != nil {
+				t.Fatalf("staging the upload: %v", err)
+			}
+
+			body := `{"token": "` + presigned.Token + `", "compress_sizes": [{"width": 100, "height": 75, "format": "webp"}]`
+			if tt.options != "" {
+				body += ", " + tt.options
+			}
+			rec = httptest.NewRecorder()
+			h.CompleteUpload(rec, httptest.NewRequest(http.MethodPost, "/api/v1/complete", strings.NewReader(body+"}")))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("complete: status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantErrorCode != "" {
+				var errResp models.ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Code != tt.wantErrorCode {
+					t.Errorf("error body %s, want code %s", rec.Body, tt.wantErrorCode)
+				}
+				return
+			}
+			var resp models.UploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if resp.OriginalImage.Width != tt.wantWidth {
+				t.Errorf("original is %d wide, want %d", resp.OriginalImage.Width, tt.wantWidth)
+			}
+			if (resp.Histogram != nil) != tt.wantHistogram {
+				t.Errorf("histogram = %v, want one: %v", resp.Histogram, tt.wantHistogram)
+			}
+			warned := strings.Contains(strings.Join(resp.Warnings, "\n"), tt.wantWarning)
+			if tt.wantWarning != "" && !warned {
+				t.Errorf("warnings %q don't mention %s", resp.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
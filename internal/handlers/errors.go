@@ -0,0 +1,173 @@
+// internal/handlers/errors.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"image-upload-server/internal/config"
+	"image-upload-server/internal/logging"
+	"image-upload-server/internal/models"
+)
+
+// Error body formats
+const (
+	ErrorFormatDefault = "default" // models.ErrorResponse
+	ErrorFormatProblem = "problem" // RFC 7807 application/problem+json
+)
+
+// problemContentType is the media type of RFC 7807 error bodies
+const problemContentType = "application/problem+json"
+
+// errorFormatKey is the context key for the negotiated error body format
+type errorFormatKey struct{}
+
+// problemSettings is what respondWithError needs to render problem+json
+type problemSettings struct {
+	typeBaseURL string
+}
+
+// Machine-readable codes returned in ErrorResponse.Code
+const (
+	codeInvalidRequest       = "INVALID_REQUEST"
+	codeInvalidCompressSizes = "INVALID_COMPRESS_SIZES"
+	codeInvalidSpec          = "INVALID_SPEC"
+	codeUnsupportedFileType  = "UNSUPPORTED_FILE_TYPE"
+	codeImageTooSmall        = "IMAGE_TOO_SMALL"
+	codePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	codeUnauthorized         = "UNAUTHORIZED"
+	codeForbidden            = "FORBIDDEN"
+	codeNotFound             = "NOT_FOUND"
+	codeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	codeProcessingFailed     = "PROCESSING_FAILED"
+	codeServerBusy           = "SERVER_BUSY"
+	codeRateLimited          = "RATE_LIMITED"
+	codeKeyConflict          = "KEY_CONFLICT"
+	codeNameCollision        = "NAME_COLLISION"
+	codeDestinationExists    = "DESTINATION_EXISTS"
+	codeBackfillRunning      = "BACKFILL_RUNNING"
+	codeInvalidUploadToken   = "INVALID_UPLOAD_TOKEN"
+	codeUploadMismatch       = "UPLOAD_MISMATCH"
+	codeChecksumMismatch     = "CHECKSUM_MISMATCH"
+	codeTimeout              = "TIMEOUT"
+	codeNotSupported         = "NOT_SUPPORTED"
+	codeRangeNotSatisfiable  = "RANGE_NOT_SATISFIABLE"
+	codeClientClosedRequest  = "CLIENT_CLOSED_REQUEST"
+	codeStorageAccessDenied  = "STORAGE_ACCESS_DENIED"
+	codeInternal             = "INTERNAL_ERROR"
+)
+
+// statusClientClosedRequest is the non-standard status, borrowed from nginx,
+// recorded when the client went away before the response
+const statusClientClosedRequest = 499
+
+// NotFound responds to requests for unknown routes
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	respondWithError(w, r, http.StatusNotFound, codeNotFound, "No route for "+r.URL.Path)
+}
+
+// MethodNotAllowed responds to requests using an unsupported method on a known route
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	respondWithError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method "+r.Method+" not allowed for "+r.URL.Path)
+}
+
+// ErrorFormat returns middleware that picks the error body format for each
+// request: problem+json when configured as the default or when the client's
+// Accept header asks for it. Wrap the whole router so unmatched routes are
+// covered too.
+func ErrorFormat(cfg config.AppConfig) func(http.Handler) http.Handler {
+	settings := &problemSettings{typeBaseURL: cfg.ProblemTypeBaseURL}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.ErrorFormat == ErrorFormatProblem || acceptsProblemJSON(r) {
+				r = r.WithContext(context.WithValue(r.Context(), errorFormatKey{}, settings))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Helper function to check whether the Accept header lists problem+json
+func acceptsProblemJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == problemContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to respond with an error in the negotiated format
+func respondWithError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	requestID := logging.RequestID(r.Context())
+	settings, ok := r.Context().Value(errorFormatKey{}).(*problemSettings)
+	if !ok {
+		respondWithJSON(w, status, models.ErrorResponse{Error: message, Code: code, RequestID: requestID})
+		return
+	}
+
+	response, _ := json.Marshal(models.ProblemDetails{
+		Type:      problemType(settings.typeBaseURL, code),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    message,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: requestID,
+	})
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// respondContextError answers a request whose work stopped on its context
+// and reports whether err was such a failure. A server-imposed deadline is
+// a 504 logged as an error; a client disconnect is only logged at debug
+// level, and its 499 is never read but keeps metrics and access logs apart.
+func (h *ImageHandler) respondContextError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		h.logger.ErrorContext(r.Context(), "Request timed out", "method", r.Method, "path", r.URL.Path, "error", err)
+		respondWithError(w, r, http.StatusGatewayTimeout, codeTimeout, "The request took too long to process")
+		return true
+	case errors.Is(err, context.Canceled) && r.Context().Err() != nil:
+		h.logger.DebugContext(r.Context(), "Request cancelled by the client", "method", r.Method, "path", r.URL.Path, "error", err)
+		respondWithError(w, r, statusClientClosedRequest, codeClientClosedRequest, "The client closed the connection")
+		return true
+	default:
+		return false
+	}
+}
+
+// respondAccessDenied answers a request storage refused the server access
+// for. It is the server's misconfiguration rather than the caller's, so a
+// 500 logged as an error, with its own code to tell it from a missing image.
+func (h *ImageHandler) respondAccessDenied(w http.ResponseWriter, r *http.Request, err error) {
+	h.logger.ErrorContext(r.Context(), "Storage denied access", "method", r.Method, "path", r.URL.Path, "error", err)
+	respondWithError(w, r, http.StatusInternalServerError, codeStorageAccessDenied, "The server is not allowed to read this image from storage")
+}
+
+// Helper function to map an error code to a problem type URI, e.g.
+// UNSUPPORTED_FILE_TYPE becomes <base>/unsupported-file-type
+func problemType(baseURL string, code string) string {
+	slug := strings.ToLower(strings.ReplaceAll(code, "_", "-"))
+	return strings.TrimSuffix(baseURL, "/") + "/" + slug
+}
+
+// requestError describes a client-facing failure detected while reading a request
+type requestError struct {
+	status  int
+	code    string
+	message string
+}
+
+// Helper function to build a 400 requestError
+func badRequest(code string, message string) *requestError {
+	return &requestError{status: http.StatusBadRequest, code: code, message: message}
+}
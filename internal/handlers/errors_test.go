@@ -0,0 +1,72 @@
+// internal/handlers/errors_test.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"image-upload-server/internal/models"
+	"image-upload-server/internal/repository"
+	"image-upload-server/internal/repository/s3test"
+)
+
+func TestGetImageStorageErrors(t *testing.T) {
+	const key = "uploads/photo.jpg"
+
+	tests := []struct {
+		name       string
+		stored     bool
+		readErr    error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "found", stored: true, wantStatus: http.StatusOK},
+		{name: "not found", wantStatus: http.StatusNotFound, wantCode: codeNotFound},
+		{name: "access denied", stored: true, readErr: s3test.ResponseError(http.StatusForbidden, errors.New("AccessDenied")),
+			wantStatus: http.StatusInternalServerError, wantCode: codeStorageAccessDenied},
+		{name: "other storage error", stored: true, readErr: s3test.ResponseError(http.StatusServiceUnavailable, errors.New("SlowDown")),
+			wantStatus: http.StatusInternalServerError, wantCode: codeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := s3test.New()
+			repo := fakeS3Repository(fake)
+			if tt.stored {
+				if _, err := repo.UploadFile(context.Background(), testJPEG(t, 40, 30), key, "image/jpeg", repository.PutOptions{}); err != nil {
+					t.Fatalf("storing the image: %v", err)
+				}
+			}
+			fake.FailRead = func(string) error { return tt.readErr }
+			h := newTestHandler(t, repo, nil)
+
+			for _, route := range []struct {
+				path    string
+				handler http.HandlerFunc
+			}{
+				{"/api/v1/images/" + key, h.GetImage},
+				{"/api/v1/images/" + key + "/raw", h.GetImageRaw},
+			} {
+				req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, route.path, nil), map[string]string{"filename": key})
+				rec := httptest.NewRecorder()
+				route.handler(rec, req)
+
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("%s: status %d, want %d: %s", route.path, rec.Code, tt.wantStatus, rec.Body)
+				}
+				if tt.wantCode == "" {
+					continue
+				}
+				var errResp models.ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Code != tt.wantCode {
+					t.Errorf("%s: error body %s, want code %s", route.path, rec.Body, tt.wantCode)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// internal/handlers/files.go
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"image-upload-server/internal/repository"
+)
+
+// LocalFiles serves the files of the local storage backend from dir under
+// prefix, answering directory requests with 404 rather than a listing, as
+// well as requests for files still being written
+func LocalFiles(prefix string, dir string) http.Handler {
+	files := http.StripPrefix(prefix, http.FileServer(http.Dir(dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") || strings.HasPrefix(path.Base(r.URL.Path), repository.LocalTempPrefix) {
+			NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,44 @@
+// internal/handlers/files_test.go
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"image-upload-server/internal/repository"
+)
+
+func TestLocalFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "uploads"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"photo.jpg", repository.LocalTempPrefix + "123456"} {
+		if err := os.WriteFile(filepath.Join(dir, "uploads", name), []byte("image"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := LocalFiles("/files/", dir)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/files/uploads/photo.jpg", wantStatus: http.StatusOK},
+		{path: "/files/uploads/", wantStatus: http.StatusNotFound},
+		{path: "/files/uploads/" + repository.LocalTempPrefix + "123456", wantStatus: http.StatusNotFound},
+		{path: "/files/uploads/%2Eupload-123456", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("GET %s: status %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
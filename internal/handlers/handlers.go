@@ -2,137 +2,885 @@
 package handlers
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
-	"path/filepath"
+	"path"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/gorilla/mux"
 
+	"image-upload-server/internal/config"
 	"image-upload-server/internal/models"
+	"image-upload-server/internal/repository"
 	"image-upload-server/internal/service"
 )
 
 // ImageHandler handles HTTP requests for image operations
 type ImageHandler struct {
 	service *service.ImageService
+	cfg     config.AppConfig
+	metrics *liteMetrics
+	logger  *slog.Logger
 }
 
 // NewImageHandler creates a new image handler
-func NewImageHandler(svc *service.ImageService) *ImageHandler {
+func NewImageHandler(svc *service.ImageService, cfg config.AppConfig, logger *slog.Logger) *ImageHandler {
 	return &ImageHandler{
 		service: svc,
+		cfg:     cfg,
+		metrics: &liteMetrics{started: time.Now()},
+		logger:  logger,
 	}
 }
 
 // Upload handles image upload requests
 // @Summary Upload an image
-// @Description Upload and compress an image based on specified sizes, then store in S3
+// @Description Upload and compress an image based on specified sizes, then store in S3. When the server allows batches, repeat the image field to upload several images with the same options: the response is then a models.BatchUploadResponse with a result per image, so one bad file doesn't fail the others. Batches can't be asynchronous or use X-Content-SHA256, and don't set X-Variants.
 // @Tags images
 // @Accept multipart/form-data
 // @Produce json
-// @Param image formData file true "Image to upload"
-// @Param compress_sizes formData string true "JSON array of compression specifications [{'width': 100, 'height': 100}, ...]"
+// @Param image formData file true "Image to upload (JPEG, PNG, WebP or GIF; animated GIFs stay animated for gif output); repeat for a batch, up to the server's limit"
+// @Param X-Image-Profile header string false "Named processing profile supplying default format, quality, resize algorithm and presets"
+// @Param X-Collection header string false "Logical collection stored as a key segment after the caller's namespace; letters, digits, '.', '-' and '_', up to 64 characters"
+// @Param X-Image-Quality header int false "Default JPEG and WebP quality, 1-100, for specs without their own; an invalid value is ignored with a warning"
+// @Param Save-Data header string false "Client hint; on lowers the quality of lossy images by the server's Save-Data reduction" Enums(on)
+// @Param X-Network-Quality header string false "Set to low for the same reduced quality as Save-Data: on" Enums(low)
+// @Param X-Content-SHA256 header string false "SHA-256 of the file, hex or base64; the upload is rejected with 400 CHECKSUM_MISMATCH if the received bytes differ"
+// @Param compress_sizes formData string false "JSON array of compression specifications [{'width': 100, 'height': 100}, ...]; required unless a preset applies. A spec's interpolation trades speed for quality: nearest and bilinear are fastest but alias and blur, bicubic and mitchell are a middle ground, lanczos2 and lanczos3 (the default) are sharpest and slowest."
+// @Param preset formData string false "Named size set of the profile, used instead of compress_sizes"
+// @Param storage_class formData string false "S3 storage class for the original, e.g. GLACIER; defaults to the server setting"
+// @Param variant_storage_class formData string false "S3 storage class for the compressed images; defaults to the server setting"
+// @Param sort formData string false "Order of compressed_images; defaults to the server setting (request order unless configured)" Enums(request, area_asc, area_desc)
+// @Param debug query bool false "Include processing diagnostics; only when the server allows debug responses"
+// @Param histogram query bool false "Include a 256-bucket histogram per channel of the decoded image"
+// @Param async query bool false "Process in the background: responds with 202 and a Location to poll with GET /jobs/{id}; only when the server allows asynchronous uploads"
+// @Param folder formData string false "Optional sub-path to store the images under, e.g. products/shoes"
+// @Param format formData string false "Default output format for specs without their own (jpeg, png, webp, gif, auto); defaults to the source format. auto picks per variant from sampled content: PNG for flat graphics (at most 256 colours or mostly flat areas), lossy WebP for photos with transparency, JPEG for other photos."
+// @Param png_compression formData string false "zlib effort for PNG output: best_compression gives the smallest files for the most CPU, best_speed is fastest but larger, none skips compression; defaults to the server setting. An invalid value is ignored with a warning." Enums(none, best_speed, default, best_compression)
+// @Param lossless formData bool false "Use lossless WebP for webp specs without their own lossless field. Much smaller than lossy for flat-colour graphics and screenshots, usually larger for photos."
+// @Param brightness formData number false "Brightness shift in percent of full scale, -100 to 100, applied before resizing"
+// @Param contrast formData number false "Contrast change in percent around mid-grey, -100 to 100, applied before resizing"
+// @Param trim formData bool false "Crop uniform-colour borders, taking the top-left pixel as the border colour, before resizing"
+// @Param trim_tolerance formData number false "How far in percent of full scale a border pixel may differ from the corner colour, 0 to 100" default(10)
 // @Success 200 {object} models.UploadResponse
+// @Header 200 {string} X-Upload-Warning "Set when the file exceeds the recommended upload size"
+// @Header 200 {string} X-Variants "Comma-separated WxH:url per compressed image, when enabled on the server"
+// @Header 200 {int} X-Variants-Omitted "Number of compressed images left out of X-Variants to keep it within the size limit"
+// @Success 202 {object} models.UploadJob
+// @Header 202 {string} Location "Polling URL of the asynchronous upload"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Header 429 {string} Retry-After "Seconds until the client may upload again"
 // @Failure 500 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Header 503 {string} Retry-After "Seconds to wait before retrying"
+// @Failure 504 {object} models.ErrorResponse
 // @Router /upload [post]
 func (h *ImageHandler) Upload(w http.ResponseWriter, r *http.Request) {
-	// Parse multipart form (max 32MB)
-	err := r.ParseMultipartForm(32 << 20)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Failed to parse form: "+err.Error())
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	w = recorder
+	var size int64
+	defer func() { h.metrics.recordUpload(recorder.status, size) }()
+
+	debug := r.URL.Query().Get("debug") == "true"
+	if debug && !h.cfg.AllowDebug {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Debug responses are disabled on this server")
 		return
 	}
 
-	// Get the file from the request
-	file, header, err := r.FormFile("image")
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Failed to get image file: "+err.Error())
+	// Stream the multipart body instead of buffering the whole form
+	form, reqErr := h.readUploadForm(w, r, h.cfg.MaxBatchFiles)
+	if reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
 		return
 	}
-	defer file.Close()
 
-	// Check file type
-	fileExt := strings.ToLower(filepath.Ext(header.Filename))
-	if fileExt != ".jpg" && fileExt != ".jpeg" && fileExt != ".png" {
-		respondWithError(w, http.StatusBadRequest, "Unsupported file type. Only JPG and PNG are supported")
+	for _, file := range form.files {
+		size += int64(len(file.bytes))
+	}
+	if len(form.files) > 1 {
+		h.uploadBatch(w, r, form, debug)
 		return
 	}
+	file := form.files[0]
 
-	// Read compress sizes from form data
-	compressSizesStr := r.FormValue("compress_sizes")
-	if compressSizesStr == "" {
-		respondWithError(w, http.StatusBadRequest, "Missing compress_sizes parameter")
+	// Catch corrupted transfers before any processing
+	digest, reqErr := verifyChecksum(r, file.bytes)
+	if reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
 		return
 	}
 
-	var compressSizes []models.CompressSpec
-	err = json.Unmarshal([]byte(compressSizesStr), &compressSizes)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid compress_sizes format: "+err.Error())
+	// Nudge clients towards pre-compressing large files; advisory only
+	if warning := h.softLimitWarning(file); warning != "" {
+		w.Header().Set("X-Upload-Warning", warning)
+	}
+
+	upload, reqErr := parseUploadOptions(r, form)
+	if reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
 		return
 	}
+	upload.opts.ContentSHA256 = digest
+	upload.opts.Debug = debug
 
-	// Read the entire file into memory
-	fileBytes, err := io.ReadAll(file)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to read file: "+err.Error())
+	// Process in the background when asked; the client polls the job instead
+	if r.URL.Query().Get("async") == "true" {
+		h.startUploadJob(w, r, form, upload)
 		return
 	}
 
 	// Process and upload the image
-	response, err := h.service.ProcessAndUploadImage(fileBytes, header.Filename, compressSizes)
+	response, err := h.service.ProcessAndUploadImage(r.Context(), file.bytes, file.filename, upload.compressSizes, upload.opts)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		h.respondUploadError(w, r, err)
 		return
 	}
+	response.Warnings = append(response.Warnings, upload.warnings...)
+	h.setVariantsHeader(w, response)
 
 	respondWithJSON(w, http.StatusOK, response)
 }
 
+// uploadBatch processes the images of a batch upload one after another with
+// the form's shared options. A rejected or failed image is reported in its
+// result without failing the others; only a cancelled or timed-out request
+// stops the batch, keeping the images already stored.
+func (h *ImageHandler) uploadBatch(w http.ResponseWriter, r *http.Request, form *uploadForm, debug bool) {
+	if r.URL.Query().Get("async") == "true" {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Asynchronous uploads take a single image")
+		return
+	}
+	if r.Header.Get("X-Content-SHA256") != "" {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "X-Content-SHA256 can only be checked for a single image")
+		return
+	}
+
+	upload, reqErr := parseUploadOptions(r, form)
+	if reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+	upload.opts.Debug = debug
+
+	batch := models.BatchUploadResponse{Results: make([]models.BatchUploadResult, 0, len(form.files))}
+	for _, file := range form.files {
+		result := models.BatchUploadResult{Filename: file.filename}
+		reqErr := file.err
+		if reqErr == nil {
+			opts := upload.opts
+			opts.ContentSHA256, _ = verifyChecksum(r, file.bytes)
+			response, err := h.service.ProcessAndUploadImage(r.Context(), file.bytes, file.filename, upload.compressSizes, opts)
+			if err != nil {
+				if h.respondContextError(w, r, err) {
+					return
+				}
+				reqErr = uploadFailure(err)
+			} else {
+				if warning := h.softLimitWarning(file); warning != "" {
+					response.Warnings = append(response.Warnings, warning)
+				}
+				response.Warnings = append(response.Warnings, upload.warnings...)
+				result.Status, result.Upload = http.StatusOK, response
+				batch.Succeeded++
+			}
+		}
+		if reqErr != nil {
+			result.Status = reqErr.status
+			result.Error = &models.ErrorResponse{Error: reqErr.message, Code: reqErr.code}
+			batch.Failed++
+		}
+		batch.Results = append(batch.Results, result)
+	}
+
+	respondWithJSON(w, http.StatusOK, batch)
+}
+
+// Helper function to warn about a file above the recommended upload size;
+// empty when it is within the soft limit or none is set
+func (h *ImageHandler) softLimitWarning(file uploadFile) string {
+	if h.cfg.UploadSoftLimitBytes > 0 && int64(len(file.bytes)) > h.cfg.UploadSoftLimitBytes {
+		return "file larger than recommended " + formatBytes(h.cfg.UploadSoftLimitBytes)
+	}
+	return ""
+}
+
+// startUploadJob hands an upload to a background job and responds with 202
+// and the job's polling URL in Location
+func (h *ImageHandler) startUploadJob(w http.ResponseWriter, r *http.Request, form *uploadForm, upload *uploadRequest) {
+	file := form.files[0]
+	job, err := h.service.StartUploadJob(r.Context(), file.bytes, file.filename, upload.compressSizes, upload.opts, upload.warnings)
+	if err != nil {
+		if errors.Is(err, service.ErrAsyncDisabled) {
+			respondWithError(w, r, http.StatusForbidden, codeForbidden, "Asynchronous uploads are disabled on this server")
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+
+	// Relative to the upload route, so it holds whatever the API prefix
+	w.Header().Set("Location", path.Join(path.Dir(r.URL.Path), "jobs", job.ID))
+	w.Header().Set("Retry-After", "1")
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// GetUploadJob handles polling of asynchronous uploads
+// @Summary Get an asynchronous upload
+// @Description Poll an upload started with POST /upload?async=true. While it is processing, responds with 202 and its progress, including an estimated completion time once there is any to go on. Once done, responds with 200 and the upload response, or with the error the upload failed with. Finished jobs are kept for the server's retention period.
+// @Tags images
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.UploadResponse
+// @Success 202 {object} models.UploadJob
+// @Header 202 {string} Retry-After "Seconds to wait before polling again"
+// @Failure 404 {object} models.ErrorResponse
+// @Router /jobs/{id} [get]
+func (h *ImageHandler) GetUploadJob(w http.ResponseWriter, r *http.Request) {
+	job, response, err := h.service.UploadJob(identityFromRequest(r), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, "Upload job not found")
+	case job.State == service.JobProcessing:
+		w.Header().Set("Retry-After", "1")
+		respondWithJSON(w, http.StatusAccepted, job)
+	case err != nil:
+		h.respondUploadError(w, r, err)
+	default:
+		h.setVariantsHeader(w, response)
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// setVariantsHeader lists the compressed images of an upload response in
+// X-Variants when enabled. Once an entry doesn't fit the size limit, it and
+// the rest are left out and counted in X-Variants-Omitted, so a proxy knows
+// to fall back to the body.
+func (h *ImageHandler) setVariantsHeader(w http.ResponseWriter, response *models.UploadResponse) {
+	if !h.cfg.VariantsHeader || len(response.CompressedImages) == 0 {
+		return
+	}
+
+	var value strings.Builder
+	omitted := 0
+	for i, image := range response.CompressedImages {
+		entry := fmt.Sprintf("%dx%d:%s", image.Width, image.Height, image.URL)
+		if value.Len() > 0 {
+			entry = ", " + entry
+		}
+		if h.cfg.VariantsHeaderMaxBytes > 0 && value.Len()+len(entry) > h.cfg.VariantsHeaderMaxBytes {
+			omitted = len(response.CompressedImages) - i
+			break
+		}
+		value.WriteString(entry)
+	}
+
+	if value.Len() > 0 {
+		w.Header().Set("X-Variants", value.String())
+	}
+	if omitted > 0 {
+		w.Header().Set("X-Variants-Omitted", strconv.Itoa(omitted))
+	}
+}
+
+// uploadRequest holds the processing options of an upload form
+type uploadRequest struct {
+	opts          service.UploadOptions
+	compressSizes []models.CompressSpec
+	// warnings are options ignored as invalid, for the response
+	warnings []string
+}
+
+// Helper function to read the processing options of an upload form and its headers
+func parseUploadOptions(r *http.Request, form *uploadForm) (*uploadRequest, *requestError) {
+	// Read compress sizes from form data; a profile preset can stand in for them
+	profile := r.Header.Get("X-Image-Profile")
+	preset := form.values["preset"]
+	compressSizesStr := form.values["compress_sizes"]
+	if compressSizesStr == "" && profile == "" && preset == "" {
+		return nil, badRequest(codeInvalidRequest, "Missing compress_sizes parameter")
+	}
+
+	var compressSizes []models.CompressSpec
+	var err error
+	if compressSizesStr != "" {
+		if compressSizes, err = parseCompressSizes(compressSizesStr); err != nil {
+			return nil, badRequest(codeInvalidCompressSizes, "Invalid compress_sizes format: "+err.Error())
+		}
+	}
+
+	// X-Collection was validated with the other headers before the body was read
+	collection := r.Header.Get("X-Collection")
+
+	folder := form.values["folder"]
+	if !validFolder(folder) {
+		return nil, badRequest(codeInvalidRequest, "Invalid folder: must not contain '.' or '..' segments, backslashes or control characters")
+	}
+
+	lossless := false
+	if value := form.values["lossless"]; value != "" {
+		if lossless, err = strconv.ParseBool(value); err != nil {
+			return nil, badRequest(codeInvalidRequest, "lossless must be true or false")
+		}
+	}
+
+	var adjustments [2]float64
+	for i, field := range []string{"brightness", "contrast"} {
+		if value := form.values[field]; value != "" {
+			if adjustments[i], err = strconv.ParseFloat(value, 64); err != nil {
+				return nil, badRequest(codeInvalidRequest, field+" must be a number")
+			}
+		}
+	}
+
+	trim := false
+	if value := form.values["trim"]; value != "" {
+		if trim, err = strconv.ParseBool(value); err != nil {
+			return nil, badRequest(codeInvalidRequest, "trim must be true or false")
+		}
+	}
+	trimTolerance := float64(service.DefaultTrimTolerance)
+	if value := form.values["trim_tolerance"]; value != "" {
+		if trimTolerance, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, badRequest(codeInvalidRequest, "trim_tolerance must be a number")
+		}
+	}
+
+	var warnings []string
+	quality, qualityWarning := requestQuality(r)
+	if qualityWarning != "" {
+		warnings = append(warnings, qualityWarning)
+	}
+	pngCompression, pngWarning := pngCompressionOption(form.values["png_compression"])
+	if pngWarning != "" {
+		warnings = append(warnings, pngWarning)
+	}
+
+	opts := service.UploadOptions{
+		Tenant:              identityFromRequest(r),
+		Collection:          collection,
+		Folder:              folder,
+		Format:              form.values["format"],
+		Quality:             quality,
+		SaveData:            saveData(r),
+		Lossless:            lossless,
+		PNGCompression:      pngCompression,
+		Profile:             profile,
+		Preset:              preset,
+		Histogram:           r.URL.Query().Get("histogram") == "true",
+		Sort:                form.values["sort"],
+		StorageClass:        form.values["storage_class"],
+		VariantStorageClass: form.values["variant_storage_class"],
+		Brightness:          adjustments[0],
+		Contrast:            adjustments[1],
+		Trim:                trim,
+		TrimTolerance:       trimTolerance,
+	}
+	return &uploadRequest{opts: opts, compressSizes: compressSizes, warnings: warnings}, nil
+}
+
+// Helper function to check a requested PNG compression; an unknown one is
+// dropped, so the server setting applies, and reported in a warning
+func pngCompressionOption(value string) (string, string) {
+	if service.ValidPNGCompression(value) {
+		return value, ""
+	}
+	return "", fmt.Sprintf("png_compression %q ignored: use none, best_speed, default or best_compression", value)
+}
+
 // GetImage handles image retrieval requests
 // @Summary Get image information
-// @Description Get information about an uploaded image by filename
+// @Description Get information about an uploaded image by filename; width, height and format are read from the stored image. With w and/or h, redirects to that variant of the image instead, generating it on first request when lazy variants are enabled and caching it by its transform.
 // @Tags images
 // @Produce json
 // @Param filename path string true "Image filename"
+// @Param w query int false "Variant width in pixels, at most IMAGE_LAZY_VARIANT_MAX_DIMENSION (4096 unless configured)"
+// @Param h query int false "Variant height in pixels, at most IMAGE_LAZY_VARIANT_MAX_DIMENSION (4096 unless configured)"
+// @Param format query string false "Variant output format (jpeg, png, webp); defaults to the original's"
+// @Param fit query string false "Variant fit mode" Enums(fill, contain, cover)
+// @Param quality query int false "Variant JPEG or WebP quality, 1-100"
+// @Param interpolation query string false "Variant resize interpolation, fastest to sharpest; defaults to the server's (lanczos3 unless configured)" Enums(nearest, bilinear, bicubic, mitchell, lanczos2, lanczos3)
 // @Success 200 {object} models.ImageResult
+// @Header 200 {string} Last-Modified "When the stored object last changed"
+// @Success 302 "Redirect to the variant"
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /images/{filename} [get]
 func (h *ImageHandler) GetImage(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	filename := vars["filename"]
+	filename, ok := filenameParam(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("w") || query.Has("h") {
+		h.redirectToVariant(w, r, filename)
+		return
+	}
 
 	// Get image info from service
-	imageInfo, err := h.service.GetImageInfo(filename)
+	imageInfo, err := h.service.GetImageInfo(r.Context(), identityFromRequest(r), filename)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Image not found")
+		switch {
+		case errors.Is(err, service.ErrImageNotFound):
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "Image not found")
+		case errors.Is(err, service.ErrStorageAccessDenied):
+			h.respondAccessDenied(w, r, err)
+		default:
+			if !h.respondContextError(w, r, err) {
+				respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Failed to read image: "+err.Error())
+			}
+		}
 		return
 	}
 
+	if imageInfo.LastModified != nil {
+		w.Header().Set("Last-Modified", imageInfo.LastModified.Format(http.TimeFormat))
+	}
+
 	respondWithJSON(w, http.StatusOK, imageInfo)
 }
 
+// GetImageRaw handles image download requests
+// @Summary Download an image
+// @Description Stream the stored bytes of an image with its Content-Type and Content-Length. A single-range Range header is passed on to storage, so interrupted downloads can resume; the range is answered with 206 and Content-Range.
+// @Tags images
+// @Produce octet-stream
+// @Param filename path string true "Image filename"
+// @Param Range header string false "Byte range to return, e.g. bytes=1024-"
+// @Success 200 {file} binary "Image bytes"
+// @Success 206 {file} binary "Requested range of the image"
+// @Header 200 {string} ETag "Entity tag of the stored object"
+// @Header 200 {string} Last-Modified "When the stored object last changed"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 416 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /images/{filename}/raw [get]
+func (h *ImageHandler) GetImageRaw(w http.ResponseWriter, r *http.Request) {
+	filename, ok := filenameParam(w, r)
+	if !ok {
+		return
+	}
+
+	stream, err := h.service.OpenImage(r.Context(), identityFromRequest(r), filename, r.Header.Get("Range"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrImageNotFound):
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "Image not found")
+		case errors.Is(err, repository.ErrRangeNotSatisfiable):
+			respondWithError(w, r, http.StatusRequestedRangeNotSatisfiable, codeRangeNotSatisfiable, "Requested range lies outside the image")
+		case errors.Is(err, service.ErrStorageAccessDenied):
+			h.respondAccessDenied(w, r, err)
+		default:
+			if !h.respondContextError(w, r, err) {
+				respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Failed to read image: "+err.Error())
+			}
+		}
+		return
+	}
+	defer stream.Body.Close()
+
+	header := w.Header()
+	header.Set("Content-Type", cmp.Or(stream.ContentType, "application/octet-stream"))
+	header.Set("Accept-Ranges", "bytes")
+	if stream.ContentLength >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(stream.ContentLength, 10))
+	}
+	if stream.ETag != "" {
+		header.Set("ETag", stream.ETag)
+	}
+	if !stream.LastModified.IsZero() {
+		header.Set("Last-Modified", stream.LastModified.UTC().Format(http.TimeFormat))
+	}
+	status := http.StatusOK
+	if stream.ContentRange != "" {
+		header.Set("Content-Range", stream.ContentRange)
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	if _, err := io.Copy(w, stream.Body); err != nil {
+		// The status is sent; all that is left is to stop writing
+		h.logger.WarnContext(r.Context(), "Failed to stream image", "filename", filename, "error", err)
+	}
+}
+
+// DeleteImage handles image deletion requests
+// @Summary Delete an image
+// @Description Delete an image, optionally together with its compressed and on-demand variants
+// @Tags images
+// @Param filename path string true "Image filename"
+// @Param variants query bool false "Also delete the variants sharing the image's name and token"
+// @Success 204 "Deleted"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /images/{filename} [delete]
+func (h *ImageHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	filename, ok := filenameParam(w, r)
+	if !ok {
+		return
+	}
+	withVariants := r.URL.Query().Get("variants") == "true"
+
+	if err := h.service.DeleteImage(r.Context(), identityFromRequest(r), filename, withVariants); err != nil {
+		if errors.Is(err, service.ErrImageNotFound) {
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "Image not found")
+			return
+		}
+		if h.respondContextError(w, r, err) {
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Failed to delete image: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveImage handles image move requests
+// @Summary Move an image
+// @Description Move an image to another key: S3 copies it and the old key is deleted. The variants made at upload move along, renamed after the destination; on-demand variants are dropped. An existing destination is only replaced with overwrite, which defaults to the server setting; its variants are deleted along with it. Only registered with authentication enabled or ADMIN_ROUTES_WITHOUT_AUTH set.
+// @Tags images
+// @Accept json
+// @Produce json
+// @Param filename path string true "Image filename"
+// @Param request body models.MoveRequest true "Destination key"
+// @Success 200 {object} models.ImageResult
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /images/{filename}/move [post]
+func (h *ImageHandler) MoveImage(w http.ResponseWriter, r *http.Request) {
+	filename, ok := filenameParam(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.MoveRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormValueBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid move request: "+err.Error())
+		return
+	}
+	destination := request.Destination
+	if !validKey(destination) || strings.HasSuffix(destination, "/") {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid destination: must be a key without leading or trailing '/', '.' or '..' segments, backslashes or control characters")
+		return
+	}
+
+	result, err := h.service.MoveImage(r.Context(), identityFromRequest(r), filename, destination, request.Overwrite)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrImageNotFound):
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "Image not found")
+		case errors.Is(err, service.ErrInvalidSpec):
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		case errors.Is(err, service.ErrDestinationExists):
+			respondWithError(w, r, http.StatusConflict, codeDestinationExists, err.Error())
+		default:
+			if !h.respondContextError(w, r, err) {
+				respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Failed to move image: "+err.Error())
+			}
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// redirectToVariant sends the client to a transformed variant of an original image
+func (h *ImageHandler) redirectToVariant(w http.ResponseWriter, r *http.Request, filename string) {
+	query := r.URL.Query()
+
+	width, errW := strconv.Atoi(query.Get("w"))
+	height, errH := strconv.Atoi(query.Get("h"))
+	if (query.Has("w") && errW != nil) || (query.Has("h") && errH != nil) {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "w and h must be integers")
+		return
+	}
+	quality, errQ := strconv.Atoi(query.Get("quality"))
+	if query.Has("quality") && errQ != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "quality must be an integer")
+		return
+	}
+
+	spec := models.CompressSpec{
+		Width:   width,
+		Height:  height,
+		Format:  query.Get("format"),
+		Fit:     query.Get("fit"),
+		Quality: quality,
+		// Validated with the rest of the spec
+		Interpolation: query.Get("interpolation"),
+	}
+	variantURL, err := h.service.Variant(r.Context(), identityFromRequest(r), filename, spec)
+	if err != nil {
+		if h.respondContextError(w, r, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrImageNotFound):
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "Image not found")
+		case errors.Is(err, service.ErrInvalidSpec):
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidSpec, err.Error())
+		case errors.Is(err, service.ErrBusy):
+			respondBusy(w, r, err)
+		default:
+			respondWithError(w, r, http.StatusInternalServerError, codeProcessingFailed, err.Error())
+		}
+		return
+	}
+
+	http.Redirect(w, r, variantURL, http.StatusFound)
+}
+
+// maxSignedURLExpiry is the longest lifetime S3 accepts for a presigned URL
+const maxSignedURLExpiry = 7 * 24 * time.Hour
+
+// SignedURL handles presigned URL requests
+// @Summary Get a presigned URL
+// @Description Create a time-limited GET URL for an image. Use disposition=attachment for forced-download links; the Content-Disposition filename is the image's download_filename.
+// @Tags images
+// @Produce json
+// @Param filename path string true "Image filename"
+// @Param disposition query string false "Response Content-Disposition" Enums(inline, attachment)
+// @Param content_type query string false "Response Content-Type override"
+// @Param expires query int false "Lifetime in seconds (default from server config, max 604800)"
+// @Success 200 {object} models.SignedURLResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 501 {object} models.ErrorResponse
+// @Router /images/{filename}/url [get]
+func (h *ImageHandler) SignedURL(w http.ResponseWriter, r *http.Request) {
+	filename, ok := filenameParam(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	var overrides repository.ResponseOverrides
+	switch disposition := query.Get("disposition"); disposition {
+	case "":
+	case "inline", "attachment":
+		overrides.ContentDisposition = mime.FormatMediaType(disposition, map[string]string{
+			"filename": h.service.DownloadFilename(filename),
+		})
+	default:
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "disposition must be inline or attachment")
+		return
+	}
+
+	if contentType := query.Get("content_type"); contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid content_type: "+err.Error())
+			return
+		}
+		overrides.ContentType = contentType
+	}
+
+	var expiry time.Duration
+	if expires := query.Get("expires"); expires != "" {
+		seconds, err := strconv.Atoi(expires)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > maxSignedURLExpiry {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "expires must be between 1 and 604800 seconds")
+			return
+		}
+		expiry = time.Duration(seconds) * time.Second
+	}
+
+	signed, err := h.service.SignedURL(r.Context(), identityFromRequest(r), filename, expiry, overrides)
+	if err != nil {
+		if errors.Is(err, service.ErrImageNotFound) {
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "Image not found")
+			return
+		}
+		if errors.Is(err, repository.ErrNotSupported) {
+			respondWithError(w, r, http.StatusNotImplemented, codeNotSupported, "Signed URLs are not available with this storage backend")
+			return
+		}
+		if h.respondContextError(w, r, err) {
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Failed to sign URL: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, signed)
+}
+
 // ListImages handles image listing requests
 // @Summary List all images
-// @Description List all images in the S3 bucket
+// @Description List all images in the S3 bucket, scoped to the server's environment and to the caller's namespace when authenticated. Returns object keys, or key, size and modification time per image with detailed=true.
 // @Tags images
 // @Produce json
+// @Param X-Collection header string false "Only list images of this collection"
+// @Param detailed query bool false "Return size and modification time with each key"
+// @Param sort query string false "Sort key; defaults to key order" Enums(name, size, modified)
+// @Param order query string false "Sort direction; defaults to asc" Enums(asc, desc)
+// @Param prefix query string false "Only list keys starting with this, relative to the caller's namespace"
+// @Param limit query int false "Maximum number of images returned, applied after sorting. In key order this is the page size (at most 1000)."
+// @Param token query string false "Continue a key-ordered listing from the X-Next-Token of the previous page"
+// @Param all_environments query bool false "List every environment's keys, with prefix relative to the bucket root; not available to authenticated callers or with X-Collection, and ignored unless the server allows it"
 // @Success 200 {array} string
+// @Success 200 {array} models.ListedImage
+// @Header 200 {string} X-Next-Token "Token of the next page, when a paged listing has more"
+// @Header 200 {string} X-List-Warning "Set when all_environments was ignored"
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /images [get]
 func (h *ImageHandler) ListImages(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	collection := r.Header.Get("X-Collection")
+	if !validCollection(collection) {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid X-Collection: use up to 64 letters, digits, '.', '-' or '_'")
+		return
+	}
+
+	prefix := query.Get("prefix")
+	if !validFolder(prefix) {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid prefix: must not contain '.' or '..' segments, backslashes or control characters")
+		return
+	}
+
+	opts := service.ListOptions{
+		Collection: collection,
+		Prefix:     prefix,
+		Token:      query.Get("token"),
+		Sort:       query.Get("sort"),
+		Order:      query.Get("order"),
+	}
+	// Crossing environments is never the default, and only on servers that allow it
+	if query.Get("all_environments") == "true" {
+		if h.cfg.AllowAllEnvironments {
+			opts.AllEnvironments = true
+		} else {
+			h.logger.WarnContext(r.Context(), "Ignoring all_environments on a listing; set ALLOW_ALL_ENVIRONMENTS_LISTING to allow it")
+			w.Header().Set("X-List-Warning", "all_environments is not allowed on this server and was ignored")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "limit must be an integer")
+			return
+		}
+		opts.Limit = limit
+	}
+
 	// Get image list from service
-	images, err := h.service.ListImages()
+	images, next, err := h.service.ListImages(r.Context(), identityFromRequest(r), opts)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuery) {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			return
+		}
+		if h.respondContextError(w, r, err) {
+			return
+		}
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Failed to list images: "+err.Error())
+		return
+	}
+
+	if next != "" {
+		w.Header().Set("X-Next-Token", next)
+	}
+
+	if query.Get("detailed") == "true" {
+		respondWithJSON(w, http.StatusOK, images)
+		return
+	}
+
+	keys := make([]string, 0, len(images))
+	for _, image := range images {
+		keys = append(keys, image.Key)
+	}
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+// VerifyReceipt handles upload receipt verification requests
+// @Summary Verify an upload receipt
+// @Description Check that an upload response's receipt was issued by this server and matches its images. The signature is a hex HMAC-SHA256 over "HMAC-SHA256-v1", issued_at (RFC 3339, UTC) and one "<url> <width>x<height> <format>" line per image, original first, joined by newlines.
+// @Tags images
+// @Accept json
+// @Produce json
+// @Param response body models.UploadResponse true "Upload response including its receipt"
+// @Success 200 {object} models.ReceiptVerification
+// @Failure 400 {object} models.ErrorResponse
+// @Router /receipts/verify [post]
+func (h *ImageHandler) VerifyReceipt(w http.ResponseWriter, r *http.Request) {
+	var response models.UploadResponse
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormValueBytes)).Decode(&response); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid upload response: "+err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, models.ReceiptVerification{
+		Valid: h.service.VerifyReceipt(&response),
+	})
+}
+
+// StartBackfill handles format backfill requests
+// @Summary Start a format backfill
+// @Description Generate a copy in the given format of every existing upload-time variant, in the background and rate limited. Copies that already exist are skipped. Only one backfill runs at a time.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body models.BackfillRequest true "Format to add"
+// @Success 202 {object} models.BackfillStatus
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Router /admin/backfill [post]
+func (h *ImageHandler) StartBackfill(w http.ResponseWriter, r *http.Request) {
+	var request models.BackfillRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFormValueBytes)).Decode(&request); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid backfill request: "+err.Error())
+		return
+	}
+
+	status, err := h.service.StartBackfill(request.Format)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to list images: "+err.Error())
+		switch {
+		case errors.Is(err, service.ErrInvalidSpec):
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidSpec, err.Error())
+		case errors.Is(err, service.ErrBackfillRunning):
+			respondWithError(w, r, http.StatusConflict, codeBackfillRunning, err.Error())
+		default:
+			respondWithError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		}
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, images)
+	respondWithJSON(w, http.StatusAccepted, status)
+}
+
+// BackfillStatus handles backfill progress requests
+// @Summary Get backfill progress
+// @Description Report the progress of the running or most recent format backfill
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.BackfillStatus
+// @Router /admin/backfill [get]
+func (h *ImageHandler) BackfillStatus(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, h.service.BackfillStatus())
 }
 
 // HealthCheck handles health check requests
@@ -148,6 +896,144 @@ func (h *ImageHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Helper function to read the filename path parameter, responding with 400
+// unless it is a plain object key
+func filenameParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	filename := mux.Vars(r)["filename"]
+	if !validKey(filename) {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidRequest, "Invalid filename: must be a key without a leading '/', '.' or '..' segments, backslashes or control characters")
+		return "", false
+	}
+	return filename, true
+}
+
+// Helper function to check a caller-supplied object key is not empty, has
+// no leading slash and passes the same checks as a folder
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && validFolder(key)
+}
+
+// Helper function to check a caller-supplied folder can't escape its namespace
+func validFolder(folder string) bool {
+	for _, segment := range strings.Split(folder, "/") {
+		if segment == ".." || segment == "." {
+			return false
+		}
+	}
+	return !strings.ContainsFunc(folder, func(r rune) bool {
+		return r == '\\' || unicode.IsControl(r)
+	})
+}
+
+// maxCollectionLength bounds the X-Collection header
+const maxCollectionLength = 64
+
+// Helper function to check an X-Collection header is a single safe key
+// segment; the empty collection is valid and means none
+func validCollection(collection string) bool {
+	if len(collection) > maxCollectionLength || collection == "." || collection == ".." {
+		return false
+	}
+	return !strings.ContainsFunc(collection, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_')
+	})
+}
+
+// Helper function to map a failed ProcessAndUploadImage to its response
+func (h *ImageHandler) respondUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	if h.respondContextError(w, r, err) {
+		return
+	}
+	if errors.Is(err, service.ErrBusy) {
+		respondBusy(w, r, err)
+		return
+	}
+	reqErr := uploadFailure(err)
+	respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+}
+
+// Helper function to map a failed upload to its client-facing error
+func uploadFailure(err error) *requestError {
+	switch {
+	case errors.Is(err, service.ErrInvalidSpec):
+		return badRequest(codeInvalidSpec, err.Error())
+	case errors.Is(err, service.ErrImageTooSmall):
+		return badRequest(codeImageTooSmall, err.Error())
+	case errors.Is(err, service.ErrBusy):
+		return &requestError{http.StatusServiceUnavailable, codeServerBusy, err.Error()}
+	case errors.Is(err, service.ErrProcessingTimeout):
+		return &requestError{http.StatusGatewayTimeout, codeTimeout, "Processing was aborted: " + err.Error()}
+	case errors.Is(err, service.ErrKeyConflict):
+		return &requestError{http.StatusConflict, codeKeyConflict, err.Error()}
+	case errors.Is(err, service.ErrNameCollision):
+		return &requestError{http.StatusConflict, codeNameCollision, err.Error()}
+	case errors.Is(err, repository.ErrObjectTooLarge):
+		return &requestError{http.StatusRequestEntityTooLarge, codePayloadTooLarge, err.Error()}
+	default:
+		return &requestError{http.StatusInternalServerError, codeProcessingFailed, err.Error()}
+	}
+}
+
+// Helper function to read the X-Image-Quality header, returning zero and a
+// warning for the response when it is not a quality from 1 to 100
+func requestQuality(r *http.Request) (int, string) {
+	value := r.Header.Get("X-Image-Quality")
+	if value == "" {
+		return 0, ""
+	}
+	quality, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || quality < 1 || quality > 100 {
+		return 0, fmt.Sprintf("X-Image-Quality %q ignored: must be an integer from 1 to 100", value)
+	}
+	return quality, ""
+}
+
+// Helper function to check whether the client asked for smaller images,
+// via the Save-Data client hint or X-Network-Quality
+func saveData(r *http.Request) bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Save-Data")), "on") ||
+		strings.EqualFold(strings.TrimSpace(r.Header.Get("X-Network-Quality")), "low")
+}
+
+// Helper function to decode compress_sizes, rejecting unknown fields such as a mistyped "with"
+func parseCompressSizes(raw string) ([]models.CompressSpec, error) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	var specs []models.CompressSpec
+	if err := decoder.Decode(&specs); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after JSON array")
+	}
+	return specs, nil
+}
+
+// Helper function to format a byte count for human-readable messages
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	value := float64(n) / float64(div)
+	if value == float64(int64(value)) {
+		return fmt.Sprintf("%d%cB", int64(value), "KMGTPE"[exp])
+	}
+	return fmt.Sprintf("%.1f%cB", value, "KMGTPE"[exp])
+}
+
+// Helper function to reject a request while the processing queue is saturated
+func respondBusy(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Retry-After", "5")
+	respondWithError(w, r, http.StatusServiceUnavailable, codeServerBusy, err.Error())
+}
+
 // Helper function to respond with JSON
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
@@ -155,8 +1041,3 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.WriteHeader(code)
 	w.Write(response)
 }
-
-// Helper function to respond with an error
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	respondWithJSON(w, code, models.ErrorResponse{Error: message})
-}
@@ -0,0 +1,189 @@
+// internal/handlers/handlers_test.go
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"image-upload-server/internal/config"
+	"image-upload-server/internal/models"
+	"image-upload-server/internal/repository"
+	"image-upload-server/internal/repository/s3test"
+	"image-upload-server/internal/service"
+)
+
+// Helper function to create a handler over a service storing in a
+// temporary directory, with the server defaults adjusted by configure
+func newTestHandler(t *testing.T, repo repository.Storage, configure func(*config.Config)) *ImageHandler {
+	t.Helper()
+	cfg := config.New()
+	if configure != nil {
+		configure(cfg)
+	}
+	if repo == nil {
+		local, err := repository.NewLocalRepository(config.StorageConfig{LocalDir: t.TempDir()})
+		if err != nil {
+			t.Fatalf("creating local repository: %v", err)
+		}
+		repo = local
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewImageHandler(service.NewImageService(repo, cfg.Image, nil, logger), cfg.App, logger)
+}
+
+// Helper function to create an S3 repository with the default settings on top of a fake client
+func fakeS3Repository(fake *s3test.FakeS3) *repository.S3Repository {
+	cfg := config.New().S3
+	cfg.BucketName = "test-bucket"
+	return repository.NewS3RepositoryWithClient(fake, nil, cfg)
+}
+
+// Helper function to build an upload request with one image and form fields
+func newUploadRequest(t *testing.T, filename string, file []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			t.Fatalf("writing form field: %v", err)
+		}
+	}
+	part, err := form.CreateFormFile("image", filename)
+	if err != nil {
+		t.Fatalf("creating form file: %v", err)
+	}
+	part.Write(file)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+// Helper function to encode a blank JPEG of the given size
+func testJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatalf("encoding test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestUpload(t *testing.T) {
+	sizes := `[{"width": 200, "height": 150}, {"width": 100, "height": 75, "format": "png"}]`
+
+	tests := []struct {
+		name         string
+		file         []byte
+		failPut      string // Substring of the keys whose puts fail
+		wantStatus   int
+		wantCode     string
+		wantVariants int
+		wantFailed   int
+		wantStored   int
+	}{
+		{name: "success", file: testJPEG(t, 400, 300), wantStatus: http.StatusOK, wantVariants: 2, wantStored: 3},
+		{name: "decode failure", file: []byte("not an image"), wantStatus: http.StatusUnsupportedMediaType, wantCode: codeUnsupportedFileType},
+		{name: "partial compression failure", file: testJPEG(t, 400, 300), failPut: "_100x75", wantStatus: http.StatusOK, wantVariants: 1, wantFailed: 1, wantStored: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := s3test.New()
+			if tt.failPut != "" {
+				fake.FailPut = func(key string) error {
+					if strings.Contains(key, tt.failPut) {
+						return errors.New("injected put failure")
+					}
+					return nil
+				}
+			}
+			h := newTestHandler(t, fakeS3Repository(fake),
+				func(cfg *config.Config) { cfg.Image.UploadAttempts = 1 })
+
+			rec := httptest.NewRecorder()
+			h.Upload(rec, newUploadRequest(t, "photo.jpg", tt.file, map[string]string{"compress_sizes": sizes}))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantCode != "" {
+				var errResp models.ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Code != tt.wantCode {
+					t.Errorf("error body %s, want code %s", rec.Body, tt.wantCode)
+				}
+			} else {
+				var resp models.UploadResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				if len(resp.CompressedImages) != tt.wantVariants || len(resp.FailedSizes) != tt.wantFailed {
+					t.Errorf("got %d variants and %d failed sizes, want %d and %d",
+						len(resp.CompressedImages), len(resp.FailedSizes), tt.wantVariants, tt.wantFailed)
+				}
+			}
+			if stored := fake.Keys(); len(stored) != tt.wantStored {
+				t.Errorf("stored %v, want %d objects", stored, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestListImagesAllEnvironments(t *testing.T) {
+	repo, err := repository.NewLocalRepository(config.StorageConfig{LocalDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("creating local repository: %v", err)
+	}
+	for _, key := range []string{"prod/uploads/a.jpg", "staging/uploads/b.jpg"} {
+		if _, err := repo.UploadFile(context.Background(), []byte("image"), key, "image/jpeg", repository.PutOptions{}); err != nil {
+			t.Fatalf("storing %s: %v", key, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		allow       bool
+		wantKeys    []string
+		wantWarning bool
+	}{
+		{name: "not allowed", allow: false, wantKeys: []string{"prod/uploads/a.jpg"}, wantWarning: true},
+		{name: "allowed", allow: true, wantKeys: []string{"prod/uploads/a.jpg", "staging/uploads/b.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, repo, func(cfg *config.Config) {
+				cfg.Image.Environment = "prod"
+				cfg.App.AllowAllEnvironments = tt.allow
+			})
+			rec := httptest.NewRecorder()
+			h.ListImages(rec, httptest.NewRequest(http.MethodGet, "/api/v1/images?all_environments=true", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var keys []string
+			if err := json.Unmarshal(rec.Body.Bytes(), &keys); err != nil {
+				t.Fatalf("decoding listing: %v", err)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, tt.wantKeys) {
+				t.Errorf("listed %v, want %v", keys, tt.wantKeys)
+			}
+			if got := rec.Header().Get("X-List-Warning") != ""; got != tt.wantWarning {
+				t.Errorf("X-List-Warning set = %t, want %t", got, tt.wantWarning)
+			}
+		})
+	}
+}
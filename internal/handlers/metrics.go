@@ -0,0 +1,59 @@
+// internal/handlers/metrics.go
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// liteMetrics are process-lifetime upload counters, safe for concurrent use
+type liteMetrics struct {
+	started  time.Time
+	uploads  atomic.Int64 // Successful uploads
+	bytes    atomic.Int64 // Bytes received in successful uploads
+	errors   atomic.Int64 // Uploads answered with an error status
+	canceled atomic.Int64 // Uploads abandoned by the client, kept out of errors
+}
+
+// recordUpload counts a finished upload request by its response status
+func (m *liteMetrics) recordUpload(status int, size int64) {
+	if status == statusClientClosedRequest {
+		m.canceled.Add(1)
+		return
+	}
+	if status >= http.StatusBadRequest {
+		m.errors.Add(1)
+		return
+	}
+	m.uploads.Add(1)
+	m.bytes.Add(size)
+}
+
+// statusRecorder remembers the status code written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// MetricsLite handles lightweight metrics requests
+// @Summary Get upload counters
+// @Description Cumulative upload counters since the process started, for deployments without Prometheus. Only registered with authentication enabled or METRICS_LITE_WITHOUT_AUTH set.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]int64
+// @Router /metrics-lite [get]
+func (h *ImageHandler) MetricsLite(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]int64{
+		"uploads_total":         h.metrics.uploads.Load(),
+		"upload_bytes_total":    h.metrics.bytes.Load(),
+		"upload_errors_total":   h.metrics.errors.Load(),
+		"upload_canceled_total": h.metrics.canceled.Load(),
+		"uptime_seconds":        int64(time.Since(h.metrics.started).Seconds()),
+	})
+}
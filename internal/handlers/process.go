@@ -0,0 +1,118 @@
+// internal/handlers/process.go
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+)
+
+// Process handles process-only requests
+// @Summary Process an image without storing it
+// @Description Run an image through the same processing as POST /upload but return the compressed images in a multipart/mixed response instead of storing them; the original is not returned. Each part carries the image with Content-Type, a Content-Disposition filename and X-Image-Width, X-Image-Height, X-Image-Format and X-Image-Quality headers, plus X-Image-Aspect-Policy when the extreme aspect ratio policy applied, in the requested sort order. Warnings and sizes that failed are reported in X-Image-Warning and X-Failed-Size response headers. Only available when the server allows process-only requests.
+// @Tags images
+// @Accept multipart/form-data
+// @Produce multipart/mixed
+// @Param image formData file true "Image to process (JPEG, PNG, WebP or GIF)"
+// @Param X-Image-Profile header string false "Named processing profile supplying default format, quality, resize algorithm and presets"
+// @Param X-Image-Quality header int false "Default JPEG and WebP quality, 1-100, for specs without their own; an invalid value is ignored with a warning"
+// @Param Save-Data header string false "Client hint; on lowers the quality of lossy images by the server's Save-Data reduction" Enums(on)
+// @Param X-Network-Quality header string false "Set to low for the same reduced quality as Save-Data: on" Enums(low)
+// @Param X-Content-SHA256 header string false "SHA-256 of the file, hex or base64; the request is rejected with 400 CHECKSUM_MISMATCH if the received bytes differ"
+// @Param compress_sizes formData string false "JSON array of compression specifications [{'width': 100, 'height': 100}, ...]; required unless a preset applies; interpolation per spec as for POST /upload"
+// @Param preset formData string false "Named size set of the profile, used instead of compress_sizes"
+// @Param sort formData string false "Order of the parts; defaults to the server setting" Enums(request, area_asc, area_desc)
+// @Param format formData string false "Default output format for specs without their own (jpeg, png, webp, gif, auto); defaults to the source format"
+// @Param lossless formData bool false "Use lossless WebP for webp specs without their own lossless field"
+// @Param png_compression formData string false "zlib effort for PNG output, as for POST /upload" Enums(none, best_speed, default, best_compression)
+// @Param brightness formData number false "Brightness shift in percent of full scale, -100 to 100, applied before resizing"
+// @Param contrast formData number false "Contrast change in percent around mid-grey, -100 to 100, applied before resizing"
+// @Param trim formData bool false "Crop uniform-colour borders before resizing"
+// @Param trim_tolerance formData number false "How far in percent of full scale a border pixel may differ from the corner colour, 0 to 100" default(10)
+// @Success 200 {file} binary "multipart/mixed body with one part per compressed image"
+// @Header 200 {string} X-Image-Warning "Non-fatal adjustment made while processing, one header per warning"
+// @Header 200 {string} X-Failed-Size "Size that could not be produced, as WIDTHxHEIGHT FORMAT: error"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Failure 503 {object} models.ErrorResponse
+// @Failure 504 {object} models.ErrorResponse
+// @Router /process [post]
+func (h *ImageHandler) Process(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.AllowProcessOnly {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Process-only requests are disabled on this server")
+		return
+	}
+
+	form, reqErr := h.readUploadForm(w, r, 1)
+	if reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+	if _, reqErr := verifyChecksum(r, form.files[0].bytes); reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+
+	upload, reqErr := parseUploadOptions(r, form)
+	if reqErr != nil {
+		respondWithError(w, r, reqErr.status, reqErr.code, reqErr.message)
+		return
+	}
+
+	result, err := h.service.ProcessImage(r.Context(), form.files[0].bytes, form.files[0].filename, upload.compressSizes, upload.opts)
+	if err != nil {
+		h.respondUploadError(w, r, err)
+		return
+	}
+	if len(result.Images) == 0 {
+		respondWithError(w, r, http.StatusInternalServerError, codeProcessingFailed, "No size could be processed: "+result.FailedSizes[0].Error)
+		return
+	}
+
+	result.Warnings = append(result.Warnings, upload.warnings...)
+	for _, warning := range result.Warnings {
+		w.Header().Add("X-Image-Warning", warning)
+	}
+	for _, failed := range result.FailedSizes {
+		w.Header().Add("X-Failed-Size", fmt.Sprintf("%dx%d %s: %s", failed.Width, failed.Height, failed.Format, failed.Error))
+	}
+
+	// Write the parts one by one as the body streams out
+	writer := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": writer.Boundary()}))
+	w.WriteHeader(http.StatusOK)
+	for _, image := range result.Images {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", image.ContentType)
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": image.DownloadFilename}))
+		header.Set("Content-Length", strconv.Itoa(len(image.Bytes)))
+		header.Set("X-Image-Width", strconv.Itoa(image.Width))
+		header.Set("X-Image-Height", strconv.Itoa(image.Height))
+		header.Set("X-Image-Format", image.Format)
+		if image.Quality > 0 {
+			header.Set("X-Image-Quality", strconv.Itoa(image.Quality))
+		}
+		if image.AspectPolicy != "" {
+			header.Set("X-Image-Aspect-Policy", image.AspectPolicy)
+		}
+
+		part, err := writer.CreatePart(header)
+		if err == nil {
+			_, err = part.Write(image.Bytes)
+		}
+		if err != nil {
+			// The status is sent; all that is left is to stop writing
+			h.logger.WarnContext(r.Context(), "Failed to write processed image", "filename", form.files[0].filename, "error", err)
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		h.logger.WarnContext(r.Context(), "Failed to finish processed images", "filename", form.files[0].filename, "error", err)
+	}
+}
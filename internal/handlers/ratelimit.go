@@ -0,0 +1,120 @@
+// internal/handlers/ratelimit.go
+package handlers
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"image-upload-server/internal/config"
+)
+
+// rateLimitSweepInterval is how often clients that went idle are forgotten
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter gives every client a token bucket for the routes it wraps
+type RateLimiter struct {
+	limit             rate.Limit
+	burst             int
+	trustForwardedFor bool
+
+	mu        sync.Mutex
+	clients   map[string]*clientBucket
+	lastSweep time.Time
+}
+
+// clientBucket is one client's bucket and when it was last used
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter creates a limiter allowing each client cfg.UploadRateLimit
+// requests per second, in bursts of up to cfg.UploadRateBurst
+func NewRateLimiter(cfg config.AppConfig) *RateLimiter {
+	return &RateLimiter{
+		limit:             rate.Limit(cfg.UploadRateLimit),
+		burst:             max(cfg.UploadRateBurst, 1),
+		trustForwardedFor: cfg.TrustForwardedFor,
+		clients:           make(map[string]*clientBucket),
+	}
+}
+
+// Middleware rejects requests from clients over their limit with a 429 and
+// a Retry-After header giving the seconds until the next token
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	if l.limit <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reservation := l.bucket(l.clientKey(r)).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			// Give the token back; the request isn't going to use it
+			reservation.Cancel()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			respondWithError(w, r, http.StatusTooManyRequests, codeRateLimited, "Too many uploads; retry after "+delay.Round(time.Second).String())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bucket returns a client's bucket, creating it full on first use, and
+// forgets clients idle long enough for theirs to have refilled
+func (l *RateLimiter) bucket(key string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+		for client, bucket := range l.clients {
+			if now.Sub(bucket.lastSeen) > refill {
+				delete(l.clients, client)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &clientBucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+	return client.limiter
+}
+
+// Helper function to identify the client of a request: its authenticated
+// identity, derived from the API key in apikey mode, or else its IP
+// address. Only identities the authenticator set count, so made-up keys
+// can't each get a fresh bucket.
+func (l *RateLimiter) clientKey(r *http.Request) string {
+	if identity := identityFromRequest(r); identity != "" {
+		return "id:" + identity
+	}
+
+	if l.trustForwardedFor {
+		// The proxy in front appends the address it saw; earlier entries
+		// come from the client and can be forged to dodge the limit
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			entries := strings.Split(forwarded[len(forwarded)-1], ",")
+			if last := strings.TrimSpace(entries[len(entries)-1]); last != "" {
+				return "ip:" + last
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,47 @@
+// internal/handlers/requestid.go
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"image-upload-server/internal/logging"
+)
+
+// maxRequestIDLength bounds a client-supplied X-Request-ID
+const maxRequestIDLength = 128
+
+// RequestID is middleware that gives every request an ID for its log
+// records and echoes it in the X-Request-ID response header. A valid ID sent
+// by the client or a proxy is kept so logs can be correlated across services.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// Helper function to check a request ID is short printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// Helper function to generate a random request ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
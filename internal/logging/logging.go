@@ -0,0 +1,56 @@
+// internal/logging/logging.go
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log records carry the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of a context, or "" outside a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// New creates a JSON logger writing to w. Level "debug" also logs debug
+// records; anything else logs from info. Records logged with a request's
+// context get a request_id field.
+func New(w io.Writer, level string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if level == "debug" {
+		options.Level = slog.LevelDebug
+	}
+	return slog.New(contextHandler{slog.NewJSONHandler(w, options)})
+}
+
+// contextHandler adds the request ID of a record's context to the record
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds the request ID, if any, and passes the record on
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs keeps the request ID handling for derived loggers
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the request ID handling for derived loggers
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
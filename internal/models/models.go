@@ -1,27 +1,211 @@
 // internal/models/models.go
 package models
 
+import "time"
+
 // CompressSpec defines a compression specification for an image
 type CompressSpec struct {
-	Width  int `json:"width" example:"800"`  // Width in pixels
-	Height int `json:"height" example:"600"` // Height in pixels
+	Width    int    `json:"width" example:"800"`                // Width in pixels; 0 scales to the height keeping the aspect ratio
+	Height   int    `json:"height" example:"600"`               // Height in pixels; 0 scales to the width, e.g. {width: 800, height: 0}
+	Format   string `json:"format,omitempty" example:"jpeg"`    // Output format (jpeg, png, webp, gif, or auto to pick by content); defaults to the request format
+	Lossless *bool  `json:"lossless,omitempty" example:"false"` // Lossless WebP for this spec, overriding the request's lossless field
+	Fit      string `json:"fit,omitempty" example:"cover"`      // How to handle a different aspect ratio: fill (stretch, default), contain or cover
+	Quality  int    `json:"quality,omitempty" example:"92"`     // JPEG and lossy WebP quality, 1-100; defaults to the profile or server quality, ignored by PNG and GIF
+	// Resize interpolation, fastest to sharpest: nearest, bilinear, bicubic,
+	// mitchell, lanczos2 or lanczos3; defaults to the profile or server algorithm
+	Interpolation string `json:"interpolation,omitempty" example:"bilinear"`
 }
 
 // ImageResult contains information about a processed image
 type ImageResult struct {
-	Width  int    `json:"width" example:"1920"`                                          // Width in pixels
-	Height int    `json:"height" example:"1080"`                                         // Height in pixels
-	URL    string `json:"url" example:"https://bucket.s3.region.amazonaws.com/file.jpg"` // S3 URL of the image
+	Width            int        `json:"width" example:"1920"`                                          // Width in pixels
+	Height           int        `json:"height" example:"1080"`                                         // Height in pixels
+	URL              string     `json:"url" example:"https://bucket.s3.region.amazonaws.com/file.jpg"` // S3 URL of the image
+	Key              string     `json:"key" example:"uploads/file.jpg"`                                // Object key the image is stored under
+	Backend          string     `json:"backend,omitempty" example:"s3"`                                // Storage backend holding the image
+	Format           string     `json:"format,omitempty" example:"jpeg"`                               // Encoded format
+	Quality          int        `json:"quality,omitempty" example:"85"`                                // Lossy encoding quality used, omitted for lossless formats
+	QualityClamped   bool       `json:"quality_clamped,omitempty" example:"false"`                     // Set when the quality was raised to the configured minimum
+	Lossless         bool       `json:"lossless,omitempty" example:"false"`                            // Set for lossless WebP
+	ScaleX           float64    `json:"scale_x,omitempty" example:"0.5"`                               // Horizontal scale applied to the source, variant over source width; with fit cover the uniform scale before cropping
+	ScaleY           float64    `json:"scale_y,omitempty" example:"0.5"`                               // Vertical scale applied to the source, variant over source height
+	AspectPolicy     string     `json:"aspect_policy,omitempty" example:"pad"`                         // Policy applied because the source's aspect ratio was too extreme for the cover spec: crop or pad
+	DownloadFilename string     `json:"download_filename,omitempty" example:"photo-800x600.jpg"`       // Suggested filename for saving the image
+	LastModified     *time.Time `json:"last_modified,omitempty" example:"2024-05-01T12:00:00Z"`        // When the stored object last changed
+	UploadedAt       *time.Time `json:"uploaded_at,omitempty" example:"2024-05-01T12:00:00Z"`          // Upload time encoded in the key, if present
 }
 
 // UploadResponse is the response for a successful upload
 type UploadResponse struct {
-	OriginalImage    ImageResult   `json:"original_image"`                                              // Information about the original image
-	CompressedImages []ImageResult `json:"compressed_images"`                                           // Information about all compressed versions
-	Message          string        `json:"message" example:"Image uploaded and processed successfully"` // Status message
+	SourceWidth       int            `json:"source_width" example:"4032"`                                                               // Width of the uploaded image as decoded
+	SourceHeight      int            `json:"source_height" example:"3024"`                                                              // Height of the uploaded image as decoded
+	OriginalImage     ImageResult    `json:"original_image"`                                                                            // The stored original; its dimensions can differ from the source's
+	OriginalReencoded bool           `json:"original_reencoded,omitempty" example:"false"`                                              // Set when the stored original was re-encoded rather than kept byte-for-byte
+	Profile           string         `json:"profile,omitempty" example:"mobile"`                                                        // Processing profile applied, from X-Image-Profile
+	Collection        string         `json:"collection,omitempty" example:"spring-catalog"`                                             // Collection the images were stored under, from X-Collection
+	ContentSHA256     string         `json:"content_sha256" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"` // Hex SHA-256 of the uploaded bytes
+	CompressedImages  []ImageResult  `json:"compressed_images"`                                                                         // Information about all compressed versions
+	Diagnostics       *Diagnostics   `json:"diagnostics,omitempty"`                                                                     // Processing details, only for debug requests
+	Histogram         *Histogram     `json:"histogram,omitempty"`                                                                       // Per-channel histogram of the decoded source, only with histogram=true
+	FailedSizes       []FailedSize   `json:"failed_sizes,omitempty"`                                                                    // Sizes that couldn't be encoded or stored
+	Warnings          []string       `json:"warnings,omitempty" example:"1600x1200 reduced to 800x600 to avoid upscaling"`              // Non-fatal adjustments made while processing
+	Message           string         `json:"message" example:"Image uploaded and processed successfully"`                               // Status message
+	Receipt           *UploadReceipt `json:"receipt,omitempty"`                                                                         // Signed record of the upload, when receipts are enabled
+}
+
+// BatchUploadResponse is the response for an upload of several images
+type BatchUploadResponse struct {
+	Results   []BatchUploadResult `json:"results"`               // One per image, in the order they were sent
+	Succeeded int                 `json:"succeeded" example:"2"` // Images uploaded
+	Failed    int                 `json:"failed" example:"1"`    // Images rejected or failed
+}
+
+// BatchUploadResult is the outcome of one image of a batch upload
+type BatchUploadResult struct {
+	Filename string          `json:"filename" example:"photo.jpg"` // Filename of the image part
+	Status   int             `json:"status" example:"200"`         // HTTP status the image would have had uploaded on its own
+	Upload   *UploadResponse `json:"upload,omitempty"`             // The upload, when it succeeded
+	Error    *ErrorResponse  `json:"error,omitempty"`              // Why the image failed, otherwise
+}
+
+// Histogram is the per-channel tonal distribution of an image, one count per 8-bit value
+type Histogram struct {
+	Red   [256]int `json:"red"`   // Pixels per red value
+	Green [256]int `json:"green"` // Pixels per green value
+	Blue  [256]int `json:"blue"`  // Pixels per blue value
+	Alpha [256]int `json:"alpha"` // Pixels per alpha value
+}
+
+// UploadReceipt is a tamper-evident signature over an upload's images
+type UploadReceipt struct {
+	Algorithm string    `json:"algorithm" example:"HMAC-SHA256-v1"`          // Signing scheme
+	IssuedAt  time.Time `json:"issued_at" example:"2024-05-01T12:00:00Z"`    // When the receipt was signed
+	Signature string    `json:"signature" example:"9f86d081884c7d659a2f..."` // Hex-encoded signature
+}
+
+// ReceiptVerification is the response for a receipt verification request
+type ReceiptVerification struct {
+	Valid bool `json:"valid" example:"true"` // Whether the receipt matches the images and was issued by this server
+}
+
+// Diagnostics describes how an upload was processed, returned with ?debug=true
+type Diagnostics struct {
+	DetectedFormat  string             `json:"detected_format" example:"jpeg"`      // Format the decoder recognised
+	ColorModel      string             `json:"color_model" example:"YCbCr 4:2:0"`   // Decoded pixel layout
+	EXIFRotated     bool               `json:"exif_rotated" example:"false"`        // Whether an EXIF orientation was applied
+	ResizeAlgorithm string             `json:"resize_algorithm" example:"lanczos3"` // Interpolation used for variants
+	TimingsMS       map[string]float64 `json:"timings_ms"`                          // Time per processing stage in milliseconds
+	Warnings        []string           `json:"warnings,omitempty"`                  // Non-fatal adjustments and failures
+}
+
+// FailedSize describes a requested size that was skipped
+type FailedSize struct {
+	Width  int    `json:"width" example:"800"`                       // Requested width in pixels
+	Height int    `json:"height" example:"600"`                      // Requested height in pixels
+	Format string `json:"format" example:"jpeg"`                     // Output format
+	Error  string `json:"error" example:"failed to upload: timeout"` // Why it failed
+}
+
+// ListedImage is one entry of a detailed image listing
+type ListedImage struct {
+	Key          string    `json:"key" example:"products/shoes/photo_1714564800000000000.jpg"` // Object key
+	Size         int64     `json:"size" example:"204800"`                                      // Object size in bytes
+	LastModified time.Time `json:"last_modified" example:"2024-05-01T12:00:00Z"`               // When the object last changed
+}
+
+// DirectUploadRequest asks for a presigned URL to PUT an image to S3 directly
+type DirectUploadRequest struct {
+	Filename    string `json:"filename" example:"photo.jpg"`      // Upload name, with a JPG, PNG, WebP or GIF extension
+	ContentType string `json:"content_type" example:"image/jpeg"` // Content type the PUT is sent with
+	Size        int64  `json:"size" example:"204800"`             // Exact size of the file in bytes
+}
+
+// DirectUploadResponse is a presigned PUT and the token that completes it
+type DirectUploadResponse struct {
+	UploadURL string            `json:"upload_url"`                                // URL to PUT the file to
+	Method    string            `json:"method" example:"PUT"`                      // HTTP method of the upload
+	Headers   map[string]string `json:"headers"`                                   // Headers the PUT must send exactly as given
+	Token     string            `json:"token"`                                     // Signed token for POST /complete
+	ExpiresAt time.Time         `json:"expires_at" example:"2024-05-01T12:15:00Z"` // When the URL and token expire
+}
+
+// CompleteUploadRequest processes a file stored with a presigned upload URL
+type CompleteUploadRequest struct {
+	Token         string         `json:"token"`                              // Token returned with the upload URL
+	CompressSizes []CompressSpec `json:"compress_sizes"`                     // Sizes to generate; required unless a preset applies
+	Preset        string         `json:"preset,omitempty"`                   // Named size set of the profile
+	Folder        string         `json:"folder,omitempty" example:"avatars"` // Optional sub-path to store the images under
+	Format        string         `json:"format,omitempty" example:"webp"`    // Default output format for specs without their own
+	Sort          string         `json:"sort,omitempty" example:"area_asc"`  // Order of compressed_images
+	// The processing options of a multipart upload, with the same meaning and defaults
+	Lossless            bool     `json:"lossless,omitempty" example:"false"`                    // Lossless WebP for webp specs without their own lossless field
+	PNGCompression      string   `json:"png_compression,omitempty" example:"best_speed"`        // zlib effort for PNG output; an invalid value is ignored with a warning
+	Brightness          float64  `json:"brightness,omitempty" example:"10"`                     // Brightness shift in percent of full scale, -100 to 100
+	Contrast            float64  `json:"contrast,omitempty" example:"5"`                        // Contrast change in percent around mid-grey, -100 to 100
+	Trim                bool     `json:"trim,omitempty" example:"false"`                        // Crop uniform-colour borders before resizing
+	TrimTolerance       *float64 `json:"trim_tolerance,omitempty" example:"10"`                 // Border colour tolerance in percent of full scale, 0 to 100; defaults to 10
+	Histogram           bool     `json:"histogram,omitempty" example:"false"`                   // Include a 256-bucket histogram per channel of the decoded image
+	StorageClass        string   `json:"storage_class,omitempty" example:"GLACIER"`             // S3 storage class for the original; defaults to the server setting
+	VariantStorageClass string   `json:"variant_storage_class,omitempty" example:"STANDARD_IA"` // S3 storage class for the compressed images; defaults to the server setting
+}
+
+// BackfillRequest starts a format backfill
+type BackfillRequest struct {
+	Format string `json:"format" example:"webp"` // Format to add for every existing variant size
+}
+
+// BackfillStatus is the progress of a format backfill
+type BackfillStatus struct {
+	State      string     `json:"state" example:"running"`                                    // idle, running or finished
+	Format     string     `json:"format,omitempty" example:"webp"`                            // Format being added
+	Total      int        `json:"total" example:"120"`                                        // Originals found
+	Processed  int        `json:"processed" example:"40"`                                     // Originals handled so far
+	Created    int        `json:"created" example:"150"`                                      // Variants generated
+	Skipped    int        `json:"skipped" example:"10"`                                       // Variants that already existed in the format
+	Failed     int        `json:"failed" example:"1"`                                         // Originals that couldn't be converted
+	LastError  string     `json:"last_error,omitempty" example:"photo.jpg: failed to decode"` // Most recent failure
+	StartedAt  *time.Time `json:"started_at,omitempty" example:"2024-05-01T12:00:00Z"`        // When the backfill began
+	FinishedAt *time.Time `json:"finished_at,omitempty" example:"2024-05-01T12:05:00Z"`       // When it ended
+}
+
+// UploadJob is the progress of an asynchronous upload
+type UploadJob struct {
+	ID                  string     `json:"id" example:"3f9a1c2b7d4e5f60a1b2c3d4e5f60718"`                 // Job ID, part of the polling URL
+	State               string     `json:"state" example:"processing"`                                    // processing, finished or failed
+	CompletedSizes      int        `json:"completed_sizes" example:"2"`                                   // Compressed sizes done so far
+	TotalSizes          int        `json:"total_sizes" example:"4"`                                       // Compressed sizes to produce, zero until planned
+	StartedAt           time.Time  `json:"started_at" example:"2024-05-01T12:00:00Z"`                     // When the job was accepted
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty" example:"2024-05-01T12:00:05Z"` // Expected finish, once there is progress or history to go on
+	FinishedAt          *time.Time `json:"finished_at,omitempty" example:"2024-05-01T12:00:04Z"`          // When processing ended
+}
+
+// MoveRequest is the body of a move request
+type MoveRequest struct {
+	Destination string `json:"destination" example:"products/shoes/photo.jpg"` // New object key
+	Overwrite   *bool  `json:"overwrite,omitempty" example:"false"`            // Replace an existing object at the destination; defaults to the server setting
+}
+
+// SignedURLResponse is the response for a presigned URL request
+type SignedURLResponse struct {
+	URL       string    `json:"url" example:"https://bucket.s3.region.amazonaws.com/file.jpg?X-Amz-Signature=..."` // Presigned GET URL
+	ExpiresAt time.Time `json:"expires_at" example:"2024-05-01T12:15:00Z"`                                         // When the URL stops working
 }
 
 // ErrorResponse is the response for an error
 type ErrorResponse struct {
-	Error string `json:"error" example:"Invalid file format"` // Error message
+	Error     string `json:"error" example:"Invalid file format"`                             // Error message
+	Code      string `json:"code" example:"UNSUPPORTED_FILE_TYPE"`                            // Machine-readable error code
+	RequestID string `json:"request_id,omitempty" example:"4f9c2b1e7a3d4c5e8f90a1b2c3d4e5f6"` // ID of the request, as in the X-Request-ID header
+}
+
+// ProblemDetails is an RFC 7807 error body, returned instead of ErrorResponse
+// when problem+json is configured or requested via the Accept header
+type ProblemDetails struct {
+	Type      string `json:"type" example:"/problems/unsupported-file-type"`                  // URI identifying the error type
+	Title     string `json:"title" example:"Bad Request"`                                     // Short summary of the status
+	Status    int    `json:"status" example:"400"`                                            // HTTP status code
+	Detail    string `json:"detail" example:"Unsupported file type"`                          // Explanation specific to this occurrence
+	Instance  string `json:"instance" example:"/api/v1/upload"`                               // Request path that failed
+	Code      string `json:"code" example:"UNSUPPORTED_FILE_TYPE"`                            // Machine-readable error code, as in ErrorResponse
+	RequestID string `json:"request_id,omitempty" example:"4f9c2b1e7a3d4c5e8f90a1b2c3d4e5f6"` // ID of the request, as in ErrorResponse
 }
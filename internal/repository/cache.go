@@ -0,0 +1,94 @@
+// internal/repository/cache.go
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// existenceCache remembers recent HeadObject results, both found and
+// missing, so repeated checks of the same key skip S3 for a short while
+type existenceCache struct {
+	ttl     time.Duration
+	size    int
+	mu      sync.Mutex
+	entries map[string]existenceEntry
+}
+
+// existenceEntry is a cached lookup; info is nil for a missing key, err
+// holds the not-found error to return again
+type existenceEntry struct {
+	info    *FileInfo
+	err     error
+	expires time.Time
+}
+
+// Helper function to create a cache, nil when ttl or size disables it
+func newExistenceCache(ttl time.Duration, size int) *existenceCache {
+	if ttl <= 0 || size <= 0 {
+		return nil
+	}
+	return &existenceCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]existenceEntry),
+	}
+}
+
+// get returns a fresh cached lookup for a key
+func (c *existenceCache) get(key string) (existenceEntry, bool) {
+	if c == nil {
+		return existenceEntry{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return existenceEntry{}, false
+	}
+	return entry, true
+}
+
+// put stores a lookup, first dropping expired entries and then, if still
+// full, an arbitrary one
+func (c *existenceCache) put(key string, info *FileInfo, err error) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = existenceEntry{info: info, err: err, expires: time.Now().Add(c.ttl)}
+}
+
+// invalidate forgets keys that were just written or removed
+func (c *existenceCache) invalidate(keys ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
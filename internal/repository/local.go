@@ -0,0 +1,373 @@
+// internal/repository/local.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"image-upload-server/internal/config"
+)
+
+// LocalTempPrefix marks files still being written, which listings skip and
+// the file server must not serve
+const LocalTempPrefix = ".upload-"
+
+// LocalRepository stores files in a directory, for development and tests
+// without S3. Keys map to paths below the directory; the files are served
+// by the static route LocalBaseURL points at.
+type LocalRepository struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalRepository creates a repository writing below cfg.LocalDir,
+// creating the directory if needed
+func NewLocalRepository(cfg config.StorageConfig) (*LocalRepository, error) {
+	if cfg.LocalDir == "" {
+		return nil, errors.New("local storage requires LOCAL_STORAGE_DIR")
+	}
+	if err := os.MkdirAll(cfg.LocalDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage directory: %w", err)
+	}
+	return &LocalRepository{
+		dir:     cfg.LocalDir,
+		baseURL: strings.TrimSuffix(cfg.LocalBaseURL, "/"),
+	}, nil
+}
+
+// Backend names the storage implementation, reported alongside stored objects
+func (r *LocalRepository) Backend() string {
+	return BackendLocal
+}
+
+// UploadFile writes a file and returns its URL. The content is written to
+// a temporary file first, so readers never see a partial image. Storage
+// class and Cache-Control have no meaning here and are ignored.
+func (r *LocalRepository) UploadFile(ctx context.Context, fileBytes []byte, fileName string, contentType string, opts PutOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := r.writeFile(fileName, fileBytes); err != nil {
+		return "", err
+	}
+	return r.FileURL(fileName), nil
+}
+
+// FileURL returns the URL a file is served at
+func (r *LocalRepository) FileURL(fileName string) string {
+	segments := strings.Split(fileName, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return r.baseURL + "/" + strings.Join(segments, "/")
+}
+
+// ObjectURL returns the URL handed to clients for a file, always the plain FileURL
+func (r *LocalRepository) ObjectURL(ctx context.Context, fileName string) (string, error) {
+	return r.FileURL(fileName), nil
+}
+
+// DownloadFile returns the contents of a file
+func (r *LocalRepository) DownloadFile(ctx context.Context, fileName string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filePath, err := r.path(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filePath)
+}
+
+// StreamFile opens a file for reading, optionally only the byte range of an
+// HTTP Range header. Like S3, a header with several ranges or one that
+// can't be parsed gets the whole file. The caller closes the body.
+func (r *LocalRepository) StreamFile(ctx context.Context, fileName string, byteRange string) (*ObjectStream, error) {
+	info, err := r.GetFile(ctx, fileName)
+	if err != nil {
+		return nil, err
+	}
+	filePath, _ := r.path(fileName)
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &ObjectStream{
+		Body:          file,
+		ContentType:   info.ContentType,
+		ContentLength: info.Size,
+		LastModified:  info.LastModified,
+	}
+	start, length, ok := parseByteRange(byteRange, info.Size)
+	if !ok {
+		return stream, nil
+	}
+	if length == 0 {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s", ErrRangeNotSatisfiable, byteRange)
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	stream.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}
+	stream.ContentLength = length
+	stream.ContentRange = fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, info.Size)
+	return stream, nil
+}
+
+// Helper function to resolve a single-range "bytes=" header against a
+// file size. ok is false when the whole file should be served; a zero
+// length means the range is unsatisfiable.
+func parseByteRange(header string, size int64) (start int64, length int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		n = min(n, size)
+		return size - n, n, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if start >= size {
+		return 0, 0, true
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true
+}
+
+// GetFile returns the metadata of a file, failing if it doesn't exist. The
+// content type is derived from the extension, as nothing else records it.
+func (r *LocalRepository) GetFile(ctx context.Context, fileName string) (*FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filePath, err := r.path(fileName)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s: %w", fileName, fs.ErrNotExist)
+	}
+
+	return &FileInfo{
+		Key:          fileName,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(fileName)),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// DeleteFile removes a file; like S3, deleting a missing file succeeds
+func (r *LocalRepository) DeleteFile(ctx context.Context, fileName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	filePath, err := r.path(fileName)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// CopyFile copies a file to another key
+func (r *LocalRepository) CopyFile(ctx context.Context, src string, dst string) error {
+	fileBytes, err := r.DownloadFile(ctx, src)
+	if err != nil {
+		return err
+	}
+	return r.writeFile(dst, fileBytes)
+}
+
+// MoveFile moves a file to another key with a rename
+func (r *LocalRepository) MoveFile(ctx context.Context, src string, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	srcPath, err := r.path(src)
+	if err != nil {
+		return err
+	}
+	dstPath, err := r.path(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", src, dst, err)
+	}
+	return nil
+}
+
+// PresignGetURL is not supported: files are served without signatures
+func (r *LocalRepository) PresignGetURL(ctx context.Context, fileName string, expiry time.Duration, overrides ResponseOverrides) (string, time.Time, error) {
+	return "", time.Time{}, fmt.Errorf("presigned URLs are %w", ErrNotSupported)
+}
+
+// PresignPutURL is not supported: there is no endpoint to PUT files to
+func (r *LocalRepository) PresignPutURL(ctx context.Context, fileName string, contentType string, size int64, expiry time.Duration) (string, http.Header, error) {
+	return "", nil, fmt.Errorf("presigned uploads are %w", ErrNotSupported)
+}
+
+// ListFiles lists all the files whose keys start with prefix, sorted by
+// key like an S3 listing
+func (r *LocalRepository) ListFiles(ctx context.Context, prefix string) ([]FileInfo, error) {
+	// Only the directory the prefix ends in can hold matching files
+	root := r.dir
+	if idx := strings.LastIndex(prefix, "/"); idx >= 0 {
+		dir, err := r.path(prefix[:idx])
+		if err != nil {
+			return nil, err
+		}
+		root = dir
+	}
+
+	var files []FileInfo
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), LocalTempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(r.dir, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, FileInfo{Key: key, Size: stat.Size(), LastModified: stat.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(files, func(a, b FileInfo) int { return strings.Compare(a.Key, b.Key) })
+	return files, nil
+}
+
+// ListPage lists one page of up to maxKeys files (1000 when zero) after a
+// continuation token, which is the last key of the previous page, and
+// returns the token of the next page, empty on the last one
+func (r *LocalRepository) ListPage(ctx context.Context, prefix string, maxKeys int, token string) ([]FileInfo, string, error) {
+	files, err := r.ListFiles(ctx, prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	if token != "" {
+		start, _ := slices.BinarySearchFunc(files, token, func(file FileInfo, key string) int {
+			return strings.Compare(file.Key, key)
+		})
+		if start < len(files) && files[start].Key == token {
+			start++
+		}
+		files = files[start:]
+	}
+
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	if len(files) <= maxKeys {
+		return files, "", nil
+	}
+	files = files[:maxKeys]
+	return files, files[len(files)-1].Key, nil
+}
+
+// Helper function to map a key to its path, refusing keys that would
+// leave the storage directory
+func (r *LocalRepository) path(key string) (string, error) {
+	if strings.Contains(key, "\\") || !filepath.IsLocal(filepath.FromSlash(key)) || path.Clean(key) != key {
+		return "", fmt.Errorf("invalid key %q: %w", key, fs.ErrNotExist)
+	}
+	return filepath.Join(r.dir, filepath.FromSlash(key)), nil
+}
+
+// Helper function to write a file through a temporary file and a rename
+func (r *LocalRepository) writeFile(key string, fileBytes []byte) error {
+	filePath, err := r.path(key)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, LocalTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(fileBytes); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
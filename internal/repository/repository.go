@@ -3,99 +3,514 @@ package repository
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"image-upload-server/internal/config"
 )
 
+// maxSinglePartBytes is the largest object a single PutObject can store
+const maxSinglePartBytes = 5 << 30
+
+// ErrObjectTooLarge is returned for files above the single-part limit when multipart uploads are disabled
+var ErrObjectTooLarge = errors.New("object exceeds the single-part upload limit")
+
+// ErrRangeNotSatisfiable is returned when a requested byte range lies outside the object
+var ErrRangeNotSatisfiable = errors.New("requested range not satisfiable")
+
+// S3API is the part of the S3 client the repository calls, so another
+// implementation, such as an in-memory fake, can stand in for S3
+type S3API interface {
+	manager.UploadAPIClient
+	s3.ListObjectsV2APIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+}
+
 // S3Repository handles interactions with the S3 storage
 type S3Repository struct {
-	client *s3.Client
-	cfg    config.S3Config
+	client    S3API
+	presigner *s3.PresignClient // Nil when presigning is unavailable
+	cfg       config.S3Config
+	exists    *existenceCache // Nil when existence caching is disabled
+}
+
+// FileInfo describes a stored object
+type FileInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ObjectStream is an open object body, or the requested range of it
+type ObjectStream struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64  // Length of Body, -1 when unknown
+	ContentRange  string // e.g. "bytes 0-99/1234" when a range was served
+	ETag          string
+	LastModified  time.Time
+}
+
+// ResponseOverrides replaces headers S3 returns when a presigned URL is fetched
+type ResponseOverrides struct {
+	ContentDisposition string // e.g. `attachment; filename="photo.jpg"` for download links
+	ContentType        string
+}
+
+// PutOptions holds per-object upload settings
+type PutOptions struct {
+	StorageClass string // e.g. "GLACIER"; empty uses the configured default
+	CacheControl string // Cache-Control header served with the object; empty sets none
+}
+
+// ValidStorageClass reports whether S3 accepts a storage class name
+func ValidStorageClass(class string) bool {
+	for _, known := range types.StorageClass("").Values() {
+		if class == string(known) {
+			return true
+		}
+	}
+	return false
 }
 
 // NewS3Repository creates a new S3 repository
-func NewS3Repository(cfg config.S3Config) (*S3Repository, error) {
+func NewS3Repository(cfg config.S3Config, logger *slog.Logger) (*S3Repository, error) {
 	client, err := createS3Client(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	// A region mismatch otherwise only surfaces as PermanentRedirect errors on
+	// the first upload; custom endpoints don't have regions worth checking
+	if cfg.Endpoint == "" && cfg.BucketName != "" {
+		region, err := bucketRegion(client, cfg.BucketName)
+		switch {
+		case err != nil:
+			logger.Warn("Could not verify the bucket region", "bucket", cfg.BucketName, "error", err)
+		case region != cfg.Region && cfg.AutoDetectRegion:
+			logger.Info("Using the bucket's region instead of the configured one", "bucket", cfg.BucketName, "region", region, "configured_region", cfg.Region)
+			cfg.Region = region
+			if client, err = createS3Client(cfg); err != nil {
+				return nil, err
+			}
+		case region != cfg.Region:
+			return nil, fmt.Errorf("bucket %s is in region %s but AWS_REGION is %s; set AWS_REGION=%s or S3_AUTO_DETECT_REGION=true", cfg.BucketName, region, cfg.Region, region)
+		}
+	}
+
+	return NewS3RepositoryWithClient(client, s3.NewPresignClient(client), cfg), nil
+}
+
+// NewS3RepositoryWithClient creates an S3 repository on top of an existing
+// client, skipping the region check. With a nil presigner, presigned URLs
+// fail with ErrNotSupported.
+func NewS3RepositoryWithClient(client S3API, presigner *s3.PresignClient, cfg config.S3Config) *S3Repository {
 	return &S3Repository{
-		client: client,
-		cfg:    cfg,
-	}, nil
+		client:    client,
+		presigner: presigner,
+		cfg:       cfg,
+		exists:    newExistenceCache(cfg.ExistenceCacheTTL, cfg.ExistenceCacheSize),
+	}
 }
 
-// UploadFile uploads a file to S3 and returns its URL
-func (r *S3Repository) UploadFile(fileBytes []byte, fileName string, contentType string) (string, error) {
-	ctx := context.Background()
+// Backend names the storage implementation, reported alongside stored objects
+func (r *S3Repository) Backend() string {
+	return BackendS3
+}
 
-	// Upload to S3
-	_, err := r.client.PutObject(ctx, &s3.PutObjectInput{
+// UploadFile uploads a file to S3 and returns its URL. Files above the
+// multipart threshold go through the multipart uploader.
+func (r *S3Repository) UploadFile(ctx context.Context, fileBytes []byte, fileName string, contentType string, opts PutOptions) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	input := &s3.PutObjectInput{
 		Bucket:      aws.String(r.cfg.BucketName),
 		Key:         aws.String(fileName),
 		Body:        bytes.NewReader(fileBytes),
 		ContentType: aws.String(contentType),
-	})
+	}
+	if class := cmp.Or(opts.StorageClass, r.cfg.StorageClass); class != "" {
+		input.StorageClass = types.StorageClass(class)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+
+	// Upload to S3
+	var err error
+	threshold := min(r.cfg.MultipartThreshold, maxSinglePartBytes)
+	if int64(len(fileBytes)) > threshold {
+		if !r.cfg.MultipartEnabled {
+			return "", fmt.Errorf("%w: %d bytes is above %d and multipart uploads are disabled", ErrObjectTooLarge, len(fileBytes), threshold)
+		}
+		uploader := manager.NewUploader(r.client, func(u *manager.Uploader) {
+			u.PartSize = r.cfg.MultipartPartSize
+		})
+		_, err = uploader.Upload(ctx, input)
+	} else {
+		_, err = r.client.PutObject(ctx, input)
+	}
 
 	if err != nil {
 		return "", err
 	}
+	r.exists.invalidate(fileName)
 
-	// Generate URL for the uploaded file
-	var imageURL string
+	return r.ObjectURL(ctx, fileName)
+}
+
+// FileURL returns the URL of a file in S3
+func (r *S3Repository) FileURL(fileName string) string {
 	if r.cfg.Endpoint != "" {
 		// For custom S3 endpoint
-		imageURL = fmt.Sprintf("%s/%s/%s", r.cfg.Endpoint, r.cfg.BucketName, fileName)
-	} else {
-		// For AWS S3
-		imageURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", r.cfg.BucketName, r.cfg.Region, fileName)
+		return fmt.Sprintf("%s/%s/%s", r.cfg.Endpoint, r.cfg.BucketName, fileName)
+	}
+	// For AWS S3
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", r.cfg.BucketName, r.cfg.Region, fileName)
+}
+
+// ObjectURL returns the URL handed to clients for a file: a presigned GET
+// URL valid for PresignExpiry when UsePresignedURLs is set, for private
+// buckets, and the plain FileURL otherwise
+func (r *S3Repository) ObjectURL(ctx context.Context, fileName string) (string, error) {
+	if !r.cfg.UsePresignedURLs {
+		return r.FileURL(fileName), nil
 	}
 
-	return imageURL, nil
+	url, _, err := r.PresignGetURL(ctx, fileName, 0, ResponseOverrides{})
+	return url, err
 }
 
-// GetFile checks if a file exists in S3
-func (r *S3Repository) GetFile(fileName string) (bool, error) {
-	ctx := context.Background()
-	_, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
+// DownloadFile returns the contents of a file in S3
+func (r *S3Repository) DownloadFile(ctx context.Context, fileName string) ([]byte, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	resp, err := r.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(r.cfg.BucketName),
 		Key:    aws.String(fileName),
 	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
 
+// StreamFile opens a file in S3 for reading, optionally only the byte range
+// of an HTTP Range header such as "bytes=100-". The caller closes the body.
+// OperationTimeout doesn't apply, as it would cut off long downloads; the
+// caller's context bounds the transfer.
+func (r *S3Repository) StreamFile(ctx context.Context, fileName string, byteRange string) (*ObjectStream, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(r.cfg.BucketName),
+		Key:    aws.String(fileName),
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+
+	resp, err := r.client.GetObject(ctx, input)
 	if err != nil {
-		return false, err
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusRequestedRangeNotSatisfiable {
+			return nil, fmt.Errorf("%w: %s", ErrRangeNotSatisfiable, byteRange)
+		}
+		return nil, err
 	}
 
-	return true, nil
+	length := int64(-1)
+	if resp.ContentLength != nil {
+		length = *resp.ContentLength
+	}
+	return &ObjectStream{
+		Body:          resp.Body,
+		ContentType:   aws.ToString(resp.ContentType),
+		ContentLength: length,
+		ContentRange:  aws.ToString(resp.ContentRange),
+		ETag:          aws.ToString(resp.ETag),
+		LastModified:  aws.ToTime(resp.LastModified),
+	}, nil
 }
 
-// ListFiles lists all files in the S3 bucket
-func (r *S3Repository) ListFiles() ([]string, error) {
-	ctx := context.Background()
+// GetFile returns the metadata of a file in S3, failing if it doesn't exist.
+// Found and missing keys are served from the existence cache when enabled.
+func (r *S3Repository) GetFile(ctx context.Context, fileName string) (*FileInfo, error) {
+	if entry, ok := r.exists.get(fileName); ok {
+		if entry.info == nil {
+			return nil, entry.err
+		}
+		info := *entry.info
+		return &info, nil
+	}
 
-	resp, err := r.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	resp, err := r.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(r.cfg.BucketName),
+		Key:    aws.String(fileName),
 	})
 
 	if err != nil {
+		// Only a definite miss is cached; other failures may be transient
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			r.exists.put(fileName, nil, err)
+		}
 		return nil, err
 	}
 
-	var filenames []string
-	for _, obj := range resp.Contents {
-		filenames = append(filenames, *obj.Key)
+	info := &FileInfo{
+		Key:          fileName,
+		Size:         aws.ToInt64(resp.ContentLength),
+		ContentType:  aws.ToString(resp.ContentType),
+		LastModified: aws.ToTime(resp.LastModified),
+	}
+	cached := *info
+	r.exists.put(fileName, &cached, nil)
+	return info, nil
+}
+
+// DeleteFile removes a file from S3
+func (r *S3Repository) DeleteFile(ctx context.Context, fileName string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(r.cfg.BucketName),
+		Key:    aws.String(fileName),
+	})
+	r.exists.invalidate(fileName)
+	return err
+}
+
+// CopyFile copies a file to another key in the bucket. S3 copies the content
+// type, Cache-Control and other metadata along; the storage class is the
+// configured default.
+func (r *S3Repository) CopyFile(ctx context.Context, src string, dst string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(r.cfg.BucketName),
+		Key:        aws.String(dst),
+		CopySource: aws.String(copySource(r.cfg.BucketName, src)),
+	}
+	if r.cfg.StorageClass != "" {
+		input.StorageClass = types.StorageClass(r.cfg.StorageClass)
+	}
+	_, err := r.client.CopyObject(ctx, input)
+	r.exists.invalidate(dst)
+	return err
+}
+
+// MoveFile moves a file to another key. S3 has no rename, so it is a copy
+// followed by a delete; if the delete fails both keys exist.
+func (r *S3Repository) MoveFile(ctx context.Context, src string, dst string) error {
+	if err := r.CopyFile(ctx, src, dst); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dst, err)
+	}
+	if err := r.DeleteFile(ctx, src); err != nil {
+		return fmt.Errorf("copied to %s but failed to delete %s: %w", dst, src, err)
+	}
+	return nil
+}
+
+// Helper function to build the URL-encoded bucket/key a CopyObject reads from
+func copySource(bucket string, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// PresignGetURL returns a time-limited GET URL for a file and when it
+// expires, optionally overriding the response headers S3 sends with it.
+// A zero expiry uses the configured default.
+func (r *S3Repository) PresignGetURL(ctx context.Context, fileName string, expiry time.Duration, overrides ResponseOverrides) (string, time.Time, error) {
+	if r.presigner == nil {
+		return "", time.Time{}, fmt.Errorf("presigned URLs are %w", ErrNotSupported)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	if expiry <= 0 {
+		expiry = r.cfg.PresignExpiry
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(r.cfg.BucketName),
+		Key:    aws.String(fileName),
+	}
+	if overrides.ContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(overrides.ContentDisposition)
+	}
+	if overrides.ContentType != "" {
+		input.ResponseContentType = aws.String(overrides.ContentType)
+	}
+
+	expiresAt := time.Now().Add(expiry)
+	req, err := r.presigner.PresignGetObject(ctx, input, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return req.URL, expiresAt, nil
+}
+
+// PresignPutURL returns a time-limited PUT URL for storing exactly size
+// bytes of contentType under a key, and the headers the PUT must send as
+// signed. A zero expiry uses the configured default.
+func (r *S3Repository) PresignPutURL(ctx context.Context, fileName string, contentType string, size int64, expiry time.Duration) (string, http.Header, error) {
+	if r.presigner == nil {
+		return "", nil, fmt.Errorf("presigned uploads are %w", ErrNotSupported)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	if expiry <= 0 {
+		expiry = r.cfg.PresignExpiry
+	}
+
+	req, err := r.presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(r.cfg.BucketName),
+		Key:           aws.String(fileName),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Host is set by the client's HTTP library anyway
+	headers := req.SignedHeader.Clone()
+	headers.Del("Host")
+	return req.URL, headers, nil
+}
+
+// ListFiles lists all the files in the S3 bucket whose keys start with
+// prefix, following continuation tokens past the 1000-key page limit.
+// The operation timeout applies to each page.
+func (r *S3Repository) ListFiles(ctx context.Context, prefix string) ([]FileInfo, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.cfg.BucketName),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
 	}
 
-	return filenames, nil
+	var files []FileInfo
+	paginator := s3.NewListObjectsV2Paginator(r.client, input)
+	for paginator.HasMorePages() {
+		pageCtx, cancel := r.withTimeout(ctx)
+		resp, err := paginator.NextPage(pageCtx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, fileInfos(resp.Contents)...)
+	}
+
+	return files, nil
+}
+
+// ListPage lists one page of up to maxKeys files (the S3 default of 1000
+// when zero) starting at a continuation token, and returns the token of
+// the next page, empty on the last one
+func (r *S3Repository) ListPage(ctx context.Context, prefix string, maxKeys int, token string) ([]FileInfo, string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.cfg.BucketName),
+	}
+	if prefix != "" {
+		input.Prefix = aws.String(prefix)
+	}
+	if maxKeys > 0 {
+		input.MaxKeys = aws.Int32(int32(min(maxKeys, 1000)))
+	}
+	if token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+
+	resp, err := r.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if aws.ToBool(resp.IsTruncated) {
+		next = aws.ToString(resp.NextContinuationToken)
+	}
+	return fileInfos(resp.Contents), next, nil
+}
+
+// withTimeout bounds a single S3 operation by OperationTimeout, when set,
+// on top of the caller's context
+func (r *S3Repository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.cfg.OperationTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.cfg.OperationTimeout)
+}
+
+// Helper function to convert listed objects to FileInfo
+func fileInfos(objects []types.Object) []FileInfo {
+	files := make([]FileInfo, 0, len(objects))
+	for _, obj := range objects {
+		files = append(files, FileInfo{
+			Key:          aws.ToString(obj.Key),
+			Size:         aws.ToInt64(obj.Size),
+			LastModified: aws.ToTime(obj.LastModified),
+		})
+	}
+	return files
+}
+
+// Helper function to look up the region a bucket lives in
+func bucketRegion(client *s3.Client, bucket string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Buckets in us-east-1 report an empty constraint, legacy Ireland ones "EU"
+	switch resp.LocationConstraint {
+	case "":
+		return "us-east-1", nil
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1", nil
+	default:
+		return string(resp.LocationConstraint), nil
+	}
 }
 
 // Helper function to create an S3 client
@@ -103,6 +518,17 @@ func createS3Client(cfg config.S3Config) (*s3.Client, error) {
 	var awsCfg aws.Config
 	var err error
 
+	minVersion, err := tlsVersion(cfg.MinTLSVersion)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.MinVersion = minVersion
+	})
+
 	if cfg.Endpoint != "" {
 		// Using custom endpoint (like MinIO or LocalStack)
 		customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
@@ -115,6 +541,7 @@ func createS3Client(cfg config.S3Config) (*s3.Client, error) {
 
 		awsCfg, err = awsconfig.LoadDefaultConfig(context.TODO(),
 			awsconfig.WithRegion(cfg.Region),
+			awsconfig.WithHTTPClient(httpClient),
 			awsconfig.WithEndpointResolverWithOptions(customResolver),
 			awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 				cfg.AccessKeyID,
@@ -126,6 +553,7 @@ func createS3Client(cfg config.S3Config) (*s3.Client, error) {
 		// Using standard AWS S3
 		awsCfg, err = awsconfig.LoadDefaultConfig(context.TODO(),
 			awsconfig.WithRegion(cfg.Region),
+			awsconfig.WithHTTPClient(httpClient),
 			awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
 				cfg.AccessKeyID,
 				cfg.SecretAccessKey,
@@ -135,9 +563,24 @@ func createS3Client(cfg config.S3Config) (*s3.Client, error) {
 	}
 
 	if err != nil {
-		log.Printf("Failed to load AWS configuration: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
 	}
 
 	return s3.NewFromConfig(awsCfg), nil
 }
+
+// Helper function to map a TLS version name such as "1.2" to its constant
+func tlsVersion(name string) (uint16, error) {
+	switch name {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported S3_MIN_TLS_VERSION %q: use 1.0, 1.1, 1.2 or 1.3", name)
+	}
+}
@@ -0,0 +1,315 @@
+// internal/repository/s3test/fake.go
+package s3test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"image-upload-server/internal/repository"
+)
+
+// errMultipart is returned by the multipart calls, which the fake leaves out;
+// tests keep their objects below the multipart threshold
+var errMultipart = errors.New("multipart uploads are not supported by the fake S3 client")
+
+// FakeS3 is an in-memory S3API for tests. Objects live in a map keyed by
+// object key; the bucket in requests is ignored. Missing keys fail the way
+// S3 does, with a 404 response error.
+type FakeS3 struct {
+	// FailPut, when set, is called before each put and fails it with the
+	// error it returns, e.g. to make the upload of one variant fail
+	FailPut func(key string) error
+	// FailRead, when set, is called before each get and head and fails
+	// them with the error it returns
+	FailRead func(key string) error
+
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+// object is a stored object and the metadata S3 reports for it
+type object struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+// compile-time check that the fake can stand in for the S3 client
+var _ repository.S3API = (*FakeS3)(nil)
+
+// New creates an empty fake S3 client
+func New() *FakeS3 {
+	return &FakeS3{objects: make(map[string]object)}
+}
+
+// Keys returns the keys of every stored object, in key order
+func (f *FakeS3) Keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Object returns the content of a stored object
+func (f *FakeS3) Object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	obj, ok := f.objects[key]
+	return obj.data, ok
+}
+
+// PutObject stores an object, unless FailPut rejects it
+func (f *FakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := aws.ToString(params.Key)
+	if f.FailPut != nil {
+		if err := f.FailPut(key); err != nil {
+			return nil, err
+		}
+	}
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[key] = object{data: data, contentType: aws.ToString(params.ContentType), lastModified: time.Now().UTC()}
+	return &s3.PutObjectOutput{ETag: aws.String(etag(data))}, nil
+}
+
+// GetObject returns an object, or the byte range of it the input asks for
+func (f *FakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := f.readError(aws.ToString(params.Key)); err != nil {
+		return nil, err
+	}
+	obj, ok := f.lookup(aws.ToString(params.Key))
+	if !ok {
+		return nil, ResponseError(http.StatusNotFound, &types.NoSuchKey{})
+	}
+
+	data := obj.data
+	output := &s3.GetObjectOutput{
+		ContentType:  aws.String(obj.contentType),
+		ETag:         aws.String(etag(obj.data)),
+		LastModified: aws.Time(obj.lastModified),
+	}
+	if params.Range != nil {
+		start, end, ok := parseRange(aws.ToString(params.Range), int64(len(data)))
+		if !ok {
+			return nil, ResponseError(http.StatusRequestedRangeNotSatisfiable, errors.New("InvalidRange"))
+		}
+		output.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+	}
+	output.Body = io.NopCloser(bytes.NewReader(data))
+	output.ContentLength = aws.Int64(int64(len(data)))
+	return output, nil
+}
+
+// HeadObject returns an object's metadata
+func (f *FakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := f.readError(aws.ToString(params.Key)); err != nil {
+		return nil, err
+	}
+	obj, ok := f.lookup(aws.ToString(params.Key))
+	if !ok {
+		return nil, ResponseError(http.StatusNotFound, &types.NotFound{})
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(obj.data))),
+		ContentType:   aws.String(obj.contentType),
+		ETag:          aws.String(etag(obj.data)),
+		LastModified:  aws.Time(obj.lastModified),
+	}, nil
+}
+
+// DeleteObject removes an object; like S3, deleting a missing key succeeds
+func (f *FakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// CopyObject copies an object from the URL-encoded "bucket/key" copy source
+func (f *FakeS3) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	_, source, _ := strings.Cut(aws.ToString(params.CopySource), "/")
+	source, err := url.PathUnescape(source)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[source]
+	if !ok {
+		return nil, ResponseError(http.StatusNotFound, &types.NoSuchKey{})
+	}
+	obj.lastModified = time.Now().UTC()
+	f.objects[aws.ToString(params.Key)] = obj
+	return &s3.CopyObjectOutput{}, nil
+}
+
+// ListObjectsV2 lists the objects under a prefix in key order, a page of
+// up to MaxKeys (1000 by default) at a time
+func (f *FakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	prefix := aws.ToString(params.Prefix)
+	maxKeys := int(aws.ToInt32(params.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	// The continuation token is simply the first key of the next page
+	start := aws.ToString(params.ContinuationToken)
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+	for _, key := range f.Keys() {
+		if !strings.HasPrefix(key, prefix) || key < start {
+			continue
+		}
+		if len(output.Contents) == maxKeys {
+			output.IsTruncated = aws.Bool(true)
+			output.NextContinuationToken = aws.String(key)
+			break
+		}
+		obj, ok := f.lookup(key)
+		if !ok {
+			continue
+		}
+		output.Contents = append(output.Contents, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(obj.data))),
+			LastModified: aws.Time(obj.lastModified),
+			ETag:         aws.String(etag(obj.data)),
+		})
+	}
+	output.KeyCount = aws.Int32(int32(len(output.Contents)))
+	return output, nil
+}
+
+// UploadPart is not supported
+func (f *FakeS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return nil, errMultipart
+}
+
+// CreateMultipartUpload is not supported
+func (f *FakeS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, errMultipart
+}
+
+// CompleteMultipartUpload is not supported
+func (f *FakeS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, errMultipart
+}
+
+// AbortMultipartUpload is not supported
+func (f *FakeS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, errMultipart
+}
+
+// Helper function to get the injected error for a read, if any
+func (f *FakeS3) readError(key string) error {
+	if f.FailRead == nil {
+		return nil
+	}
+	return f.FailRead(key)
+}
+
+// Helper function to read an object under the lock
+func (f *FakeS3) lookup(key string) (object, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[key]
+	return obj, ok
+}
+
+// ResponseError builds the error the SDK returns for a failed request with
+// an HTTP status, e.g. ResponseError(http.StatusForbidden, errors.New("AccessDenied"))
+func ResponseError(status int, err error) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      err,
+		},
+	}
+}
+
+// Helper function to compute the quoted MD5 ETag S3 gives single-part objects
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// Helper function to resolve a single "bytes=start-end", "bytes=start-" or
+// "bytes=-suffix" range against an object's size
+func parseRange(header string, size int64) (start int64, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false
+		}
+		return max(size-suffix, 0), size - 1, size > 0
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
@@ -0,0 +1,77 @@
+// internal/repository/storage.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+
+	"image-upload-server/internal/config"
+)
+
+// Supported storage backends
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
+
+// ErrNotSupported is returned for operations the storage backend can't perform, such as presigning
+var ErrNotSupported = errors.New("not supported by the storage backend")
+
+// IsNotFound reports whether a storage error means the object doesn't
+// exist: a 404 (NotFound, NoSuchKey) from S3 or a missing local file
+func IsNotFound(err error) bool {
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound
+}
+
+// IsAccessDenied reports whether a storage error means the server's
+// credentials may not read the object: a 403 (AccessDenied, Forbidden) from
+// S3 or an unreadable local file. S3 also answers 403 for missing keys when
+// the credentials lack s3:ListBucket.
+func IsAccessDenied(err error) bool {
+	if errors.Is(err, fs.ErrPermission) {
+		return true
+	}
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden
+}
+
+// Storage stores images and their variants under object keys
+type Storage interface {
+	// Backend names the implementation, e.g. "s3"
+	Backend() string
+	UploadFile(ctx context.Context, fileBytes []byte, fileName string, contentType string, opts PutOptions) (string, error)
+	ObjectURL(ctx context.Context, fileName string) (string, error)
+	DownloadFile(ctx context.Context, fileName string) ([]byte, error)
+	StreamFile(ctx context.Context, fileName string, byteRange string) (*ObjectStream, error)
+	GetFile(ctx context.Context, fileName string) (*FileInfo, error)
+	DeleteFile(ctx context.Context, fileName string) error
+	CopyFile(ctx context.Context, src string, dst string) error
+	MoveFile(ctx context.Context, src string, dst string) error
+	PresignGetURL(ctx context.Context, fileName string, expiry time.Duration, overrides ResponseOverrides) (string, time.Time, error)
+	PresignPutURL(ctx context.Context, fileName string, contentType string, size int64, expiry time.Duration) (string, http.Header, error)
+	ListFiles(ctx context.Context, prefix string) ([]FileInfo, error)
+	ListPage(ctx context.Context, prefix string, maxKeys int, token string) ([]FileInfo, string, error)
+}
+
+// New creates the storage backend selected by the config
+func New(cfg config.StorageConfig, s3cfg config.S3Config, logger *slog.Logger) (Storage, error) {
+	switch cfg.Backend {
+	case "", BackendS3:
+		return NewS3Repository(s3cfg, logger)
+	case BackendLocal:
+		return NewLocalRepository(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported STORAGE_BACKEND %q: use s3 or local", cfg.Backend)
+	}
+}
@@ -0,0 +1,73 @@
+// internal/service/adjust.go
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// maxAdjustment bounds brightness and contrast, both given in percent
+const maxAdjustment = 100
+
+// Helper function to check brightness and contrast are within range
+func validateAdjustments(brightness, contrast float64) error {
+	if math.IsNaN(brightness) || brightness < -maxAdjustment || brightness > maxAdjustment {
+		return fmt.Errorf("%w: brightness %g outside -%d..%d", ErrInvalidSpec, brightness, maxAdjustment, maxAdjustment)
+	}
+	if math.IsNaN(contrast) || contrast < -maxAdjustment || contrast > maxAdjustment {
+		return fmt.Errorf("%w: contrast %g outside -%d..%d", ErrInvalidSpec, contrast, maxAdjustment, maxAdjustment)
+	}
+	return nil
+}
+
+// toneCurve maps a colour channel value from 0 to 255, unclamped
+type toneCurve func(v float64) float64
+
+// Helper function to get the curve that scales a channel around mid-grey by 1+contrast/100
+func contrastCurve(contrast float64) toneCurve {
+	gain := 1 + contrast/100
+	return func(v float64) float64 { return (v-128)*gain + 128 }
+}
+
+// Helper function to get the curve that shifts a channel by brightness% of full scale
+func brightnessCurve(brightness float64) toneCurve {
+	offset := brightness / 100 * 255
+	return func(v float64) float64 { return v + offset }
+}
+
+// applyCurves runs the colour channels of an image through curves in
+// order, in a single pass with the result rounded once; alpha is kept. No
+// curves return the image unchanged.
+func applyCurves(img image.Image, curves []toneCurve) image.Image {
+	if len(curves) == 0 {
+		return img
+	}
+
+	var table [256]uint8
+	for v := range table {
+		value := float64(v)
+		for _, curve := range curves {
+			value = curve(value)
+		}
+		table[v] = clampChannel(value)
+	}
+
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), img, bounds.Min, draw.Src)
+
+	for i := 0; i < len(out.Pix); i += 4 {
+		out.Pix[i] = table[out.Pix[i]]
+		out.Pix[i+1] = table[out.Pix[i+1]]
+		out.Pix[i+2] = table[out.Pix[i+2]]
+	}
+
+	return out
+}
+
+// Helper function to round and clamp a channel value to 0..255
+func clampChannel(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, v))))
+}
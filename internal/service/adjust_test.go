@@ -0,0 +1,67 @@
+// internal/service/adjust_test.go
+package service
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestValidateAdjustments(t *testing.T) {
+	tests := []struct {
+		name                 string
+		brightness, contrast float64
+		wantErr              bool
+	}{
+		{name: "no-op", brightness: 0, contrast: 0},
+		{name: "limits", brightness: -100, contrast: 100},
+		{name: "brightness too high", brightness: 100.5, wantErr: true},
+		{name: "contrast too low", contrast: -101, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAdjustments(tt.brightness, tt.contrast)
+			if got := err != nil; got != tt.wantErr {
+				t.Fatalf("validateAdjustments(%g, %g) error = %v, want error %t", tt.brightness, tt.contrast, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSpec) {
+				t.Errorf("error %v is not ErrInvalidSpec", err)
+			}
+		})
+	}
+}
+
+func TestAdjustmentsShiftKnownPixel(t *testing.T) {
+	tests := []struct {
+		name                 string
+		brightness, contrast float64
+		in, want             color.NRGBA
+	}{
+		// 100 + 10% of 255 = 125.5, rounded once
+		{name: "brightness", brightness: 10, in: color.NRGBA{100, 100, 100, 255}, want: color.NRGBA{126, 126, 126, 255}},
+		{name: "darker", brightness: -20, in: color.NRGBA{100, 200, 30, 255}, want: color.NRGBA{49, 149, 0, 255}},
+		// (100 - 128) * 1.5 + 128 = 86
+		{name: "contrast", contrast: 50, in: color.NRGBA{100, 128, 200, 255}, want: color.NRGBA{86, 128, 236, 255}},
+		// Contrast first, then brightness: 86 + 25.5 = 111.5
+		{name: "both", brightness: 10, contrast: 50, in: color.NRGBA{100, 100, 100, 255}, want: color.NRGBA{112, 112, 112, 255}},
+		{name: "clamped, alpha kept", brightness: 10, in: color.NRGBA{250, 5, 0, 128}, want: color.NRGBA{255, 31, 26, 128}},
+		{name: "no-op", in: color.NRGBA{1, 2, 3, 4}, want: color.NRGBA{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestService(t, nil)
+			img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+			for y := 0; y < 2; y++ {
+				for x := 0; x < 2; x++ {
+					img.SetNRGBA(x, y, tt.in)
+				}
+			}
+
+			out, _ := svc.runPipeline(img, UploadOptions{Brightness: tt.brightness, Contrast: tt.contrast}, newStageTimings())
+			if got := color.NRGBAModel.Convert(out.At(1, 1)).(color.NRGBA); got != tt.want {
+				t.Errorf("pixel %v became %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// internal/service/autoformat.go
+package service
+
+import (
+	"fmt"
+	"image"
+)
+
+// FormatAuto asks for the output format to be chosen from the image content
+const FormatAuto = "auto"
+
+// Thresholds of the auto format heuristic
+const (
+	autoSampleGrid     = 128  // Pixels sampled per axis
+	autoGraphicColours = 256  // At most this many distinct sampled colours is a graphic
+	autoGraphicFlat    = 0.6  // Share of sampled neighbours with identical colour that makes a graphic
+	autoOpaqueAlpha    = 0xff // Alpha of a fully opaque 8-bit pixel
+)
+
+// contentProfile summarizes the characteristics the auto format is chosen by
+type contentProfile struct {
+	colours  int     // Distinct colours among the samples, capped just past autoGraphicColours
+	flat     float64 // Share of horizontally adjacent samples with the same colour
+	hasAlpha bool
+}
+
+// graphic reports whether the image looks like flat artwork (logos,
+// screenshots, diagrams) rather than a photo
+func (c contentProfile) graphic() bool {
+	return c.colours <= autoGraphicColours || c.flat >= autoGraphicFlat
+}
+
+// format picks the output for auto specs:
+//   - graphics become PNG, which is lossless and small for flat colour
+//   - photos with transparency become lossy WebP, as JPEG has no alpha
+//   - other photos become JPEG
+func (c contentProfile) format() string {
+	switch {
+	case c.graphic():
+		return "png"
+	case c.hasAlpha:
+		return "webp"
+	default:
+		return "jpeg"
+	}
+}
+
+func (c contentProfile) String() string {
+	kind := "photo"
+	if c.graphic() {
+		kind = "graphic"
+	}
+	colours := fmt.Sprint(c.colours)
+	if c.colours > autoGraphicColours {
+		colours = fmt.Sprintf(">%d", autoGraphicColours)
+	}
+	return fmt.Sprintf("%s: %s colours, %.0f%% flat, alpha %t", kind, colours, c.flat*100, c.hasAlpha)
+}
+
+// analyzeContent samples the image on a grid and measures its colour
+// count, how much of it is flat and whether any pixel is transparent
+func analyzeContent(img image.Image) contentProfile {
+	bounds := img.Bounds()
+	stepX := max(bounds.Dx()/autoSampleGrid, 1)
+	stepY := max(bounds.Dy()/autoSampleGrid, 1)
+
+	var profile contentProfile
+	colours := make(map[uint32]struct{}, autoGraphicColours+1)
+	pairs, same := 0, 0
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		var previous uint32
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a>>8 < autoOpaqueAlpha {
+				profile.hasAlpha = true
+			}
+
+			colour := r>>8<<24 | g>>8<<16 | b>>8<<8 | a>>8
+			if len(colours) <= autoGraphicColours {
+				colours[colour] = struct{}{}
+			}
+			if x > bounds.Min.X {
+				pairs++
+				if colour == previous {
+					same++
+				}
+			}
+			previous = colour
+		}
+	}
+
+	profile.colours = len(colours)
+	if pairs > 0 {
+		profile.flat = float64(same) / float64(pairs)
+	}
+	return profile
+}
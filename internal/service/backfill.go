@@ -0,0 +1,249 @@
+// internal/service/backfill.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"image-upload-server/internal/config"
+	"image-upload-server/internal/models"
+	"image-upload-server/internal/repository"
+)
+
+// Backfill job states
+const (
+	BackfillIdle     = "idle"
+	BackfillRunning  = "running"
+	BackfillFinished = "finished"
+)
+
+// ErrBackfillRunning is returned when a backfill is started while one is in progress
+var ErrBackfillRunning = errors.New("a backfill is already running")
+
+// sizedVariantPattern matches the size segment of an upload-time variant's
+// base name, before the optional token: "photo_600x400" or "photo_600x400_<token>",
+// with a collision tag as in "photo_600x400-3f9a1c2b"
+var sizedVariantPattern = regexp.MustCompile(`_\d+x\d+(-[0-9a-f]{8})?$`)
+
+// cachedVariantPattern matches the base name of an on-demand variant
+var cachedVariantPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// backfillJob tracks the single background backfill a server runs at a time
+type backfillJob struct {
+	mu     sync.Mutex
+	status models.BackfillStatus
+}
+
+// snapshot returns a copy of the job's progress
+func (j *backfillJob) snapshot() models.BackfillStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	if status.State == "" {
+		status.State = BackfillIdle
+	}
+	return status
+}
+
+// update applies a change to the job's progress under its lock
+func (j *backfillJob) update(change func(status *models.BackfillStatus)) {
+	j.mu.Lock()
+	change(&j.status)
+	j.mu.Unlock()
+}
+
+// StartBackfill begins generating format versions of the existing
+// variants of every stored original in the background. Each variant size
+// found for an original gets a copy in the new format; copies that
+// already exist are skipped. Originals are processed at most
+// BackfillRate per second.
+func (s *ImageService) StartBackfill(format string) (models.BackfillStatus, error) {
+	normalized, ok := normalizeFormat(format)
+	if !ok {
+		return models.BackfillStatus{}, fmt.Errorf("%w: unsupported output format %q", ErrInvalidSpec, format)
+	}
+
+	s.backfill.mu.Lock()
+	if s.backfill.status.State == BackfillRunning {
+		s.backfill.mu.Unlock()
+		return models.BackfillStatus{}, ErrBackfillRunning
+	}
+	started := time.Now().UTC()
+	s.backfill.status = models.BackfillStatus{
+		State:     BackfillRunning,
+		Format:    normalized,
+		StartedAt: &started,
+	}
+	status := s.backfill.status
+	s.backfill.mu.Unlock()
+
+	// The job outlives the request that started it
+	go s.runBackfill(context.Background(), normalized)
+	return status, nil
+}
+
+// BackfillStatus reports the progress of the current or last backfill
+func (s *ImageService) BackfillStatus() models.BackfillStatus {
+	return s.backfill.snapshot()
+}
+
+// runBackfill walks the bucket and converts the variants of each original
+func (s *ImageService) runBackfill(ctx context.Context, format string) {
+	defer s.backfill.update(func(status *models.BackfillStatus) {
+		status.State = BackfillFinished
+		finished := time.Now().UTC()
+		status.FinishedAt = &finished
+	})
+
+	prefix := joinKey(s.cfg.Environment, s.cfg.KeyPrefix)
+	if prefix != "" {
+		prefix += "/"
+	}
+	files, err := s.repo.ListFiles(ctx, prefix)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Backfill failed to list images", "prefix", prefix, "error", err)
+		s.backfill.update(func(status *models.BackfillStatus) { status.LastError = err.Error() })
+		return
+	}
+
+	var originals []string
+	for _, file := range files {
+		if s.isOriginalKey(file.Key) {
+			originals = append(originals, file.Key)
+		}
+	}
+	s.backfill.update(func(status *models.BackfillStatus) { status.Total = len(originals) })
+
+	interval := time.Duration(float64(time.Second) / max(s.cfg.BackfillRate, 0.001))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for i, original := range originals {
+		if i > 0 {
+			<-ticker.C
+		}
+
+		created, skipped, err := s.backfillOriginal(ctx, original, format)
+		s.backfill.update(func(status *models.BackfillStatus) {
+			status.Processed++
+			status.Created += created
+			status.Skipped += skipped
+			if err != nil {
+				status.Failed++
+				status.LastError = fmt.Sprintf("%s: %v", original, err)
+			}
+		})
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Backfill of an original failed", "key", original, "format", format, "error", err)
+		}
+	}
+}
+
+// backfillOriginal creates the format copies of one original's variants,
+// returning how many were created and how many already existed
+func (s *ImageService) backfillOriginal(ctx context.Context, original string, format string) (int, int, error) {
+	variants, err := s.variantKeys(ctx, original)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Only upload-time sizes are mirrored; on-demand variants are made on request anyway
+	type target struct {
+		key           string
+		width, height int
+	}
+	var targets []target
+	skipped := 0
+	seen := make(map[string]bool)
+	for _, variant := range variants {
+		base := strings.TrimSuffix(path.Base(variant), path.Ext(variant))
+		if cachedVariantPattern.MatchString(base) {
+			continue
+		}
+
+		key := strings.TrimSuffix(variant, path.Ext(variant)) + formatExtension(format)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, err := s.repo.GetFile(ctx, key); err == nil {
+			skipped++
+			continue
+		}
+
+		var width, height int
+		size := sizedVariantPattern.FindString(strings.TrimSuffix(base, s.tokenSuffix(base)))
+		if _, err := fmt.Sscanf(size, "_%dx%d", &width, &height); err != nil {
+			continue
+		}
+		targets = append(targets, target{key: key, width: width, height: height})
+	}
+	if len(targets) == 0 {
+		return 0, skipped, nil
+	}
+
+	release, err := s.queue.acquire(ctx)
+	if err != nil {
+		return 0, skipped, err
+	}
+	defer release()
+
+	fileBytes, err := s.repo.DownloadFile(ctx, original)
+	if err != nil {
+		return 0, skipped, fmt.Errorf("failed to download: %w", err)
+	}
+	img, _, _, err := s.decodeUpright(fileBytes)
+	if err != nil {
+		return 0, skipped, fmt.Errorf("failed to decode: %w", err)
+	}
+
+	created := 0
+	for _, t := range targets {
+		if err := s.backfillVariant(ctx, img, t.key, t.width, t.height, format); err != nil {
+			return created, skipped, err
+		}
+		created++
+	}
+	return created, skipped, nil
+}
+
+// backfillVariant resizes, encodes and stores one format copy
+func (s *ImageService) backfillVariant(ctx context.Context, img image.Image, key string, width, height int, format string) error {
+	plan := variantPlan{
+		spec:   models.CompressSpec{Width: width, Height: height},
+		format: format,
+		fit:    FitFill,
+	}
+	plan.interpolation = s.resizeAlgorithmName(config.Profile{})
+	plan.resize, _ = resizeAlgorithm(plan.interpolation)
+	if format == "jpeg" || format == "webp" {
+		plan.quality, _ = s.effectiveQuality(s.cfg.Quality)
+	}
+
+	encoded, err := encodeImage(resizeForPlan(img, plan), format, plan.quality, false, s.pngCompression(""))
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	if _, err := s.uploadWithRetry(ctx, encoded, key, getContentType(format),
+		repository.PutOptions{CacheControl: s.cfg.VariantCacheControl}); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// isOriginalKey reports whether a key is an uploaded original rather than
+// an upload-time or on-demand variant
+func (s *ImageService) isOriginalKey(key string) bool {
+	base := strings.TrimSuffix(path.Base(key), path.Ext(key))
+	if cachedVariantPattern.MatchString(base) {
+		return false
+	}
+	return !sizedVariantPattern.MatchString(strings.TrimSuffix(base, s.tokenSuffix(base)))
+}
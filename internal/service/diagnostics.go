@@ -0,0 +1,56 @@
+// internal/service/diagnostics.go
+package service
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+
+	"image-upload-server/internal/models"
+)
+
+// diagnostics summarises how an upload was processed for debug responses
+func (s *ImageService) diagnostics(source *preparedImage, opts UploadOptions, timings *stageTimings, response *models.UploadResponse) *models.Diagnostics {
+	profile, _ := s.profile(opts.Profile)
+	algorithm := s.resizeAlgorithmName(profile)
+
+	warnings := slices.Clone(response.Warnings)
+	for _, failed := range response.FailedSizes {
+		warnings = append(warnings, fmt.Sprintf("%dx%d %s failed: %s", failed.Width, failed.Height, failed.Format, failed.Error))
+	}
+
+	return &models.Diagnostics{
+		DetectedFormat:  source.format,
+		ColorModel:      colorModelName(source.img),
+		EXIFRotated:     source.rotated,
+		ResizeAlgorithm: algorithm,
+		TimingsMS:       timings.milliseconds(),
+		Warnings:        warnings,
+	}
+}
+
+// warnings gathers the non-fatal adjustments made while processing an
+// upload, after those already noted by the pipeline
+func (s *ImageService) warnings(noted []string, plans []variantPlan, originalClamped bool) []string {
+	warnings := slices.Clone(noted)
+	for _, plan := range plans {
+		warnings = append(warnings, plan.notes...)
+	}
+	if originalClamped {
+		warnings = append(warnings, fmt.Sprintf("original quality raised to the minimum of %d", s.cfg.MinQuality))
+	}
+	return warnings
+}
+
+// Helper function to describe the decoded pixel layout, e.g. "YCbCr 4:2:0"
+func colorModelName(img image.Image) string {
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return "YCbCr " + strings.TrimPrefix(m.SubsampleRatio.String(), "YCbCrSubsampleRatio")
+	case *image.Paletted:
+		return fmt.Sprintf("Paletted (%d colours)", len(m.Palette))
+	default:
+		return strings.TrimPrefix(fmt.Sprintf("%T", img), "*image.")
+	}
+}
@@ -0,0 +1,161 @@
+// internal/service/direct.go
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"image-upload-server/internal/models"
+)
+
+// ErrDirectUploadDisabled is returned when no direct upload signing key is configured
+var ErrDirectUploadDisabled = errors.New("direct uploads are disabled")
+
+// ErrInvalidUploadToken is returned for a direct upload token that is
+// malformed, forged, expired or issued to another caller
+var ErrInvalidUploadToken = errors.New("invalid upload token")
+
+// ErrUploadMismatch is returned when the staged object differs from what its token was issued for
+var ErrUploadMismatch = errors.New("uploaded object does not match the upload token")
+
+// uploadToken is the signed payload of a direct upload token
+type uploadToken struct {
+	Key      string `json:"k"`           // Staging key the file is PUT to
+	Filename string `json:"n"`           // Upload name, used to name the processed images
+	Tenant   string `json:"t,omitempty"` // Caller the token was issued to
+	Size     int64  `json:"s"`           // Announced size in bytes
+	Expires  int64  `json:"e"`           // Unix time after which the token is rejected
+}
+
+// DirectUpload is a staged file claimed with its token, ready to be processed
+type DirectUpload struct {
+	Key      string
+	Filename string
+	Bytes    []byte
+}
+
+// PresignDirectUpload issues a presigned PUT to a staging key and the token
+// to complete the upload with. The presigned request fixes the content type
+// and size announced here.
+func (s *ImageService) PresignDirectUpload(ctx context.Context, tenant string, request models.DirectUploadRequest) (*models.DirectUploadResponse, error) {
+	if s.cfg.DirectUploadKey == "" {
+		return nil, ErrDirectUploadDisabled
+	}
+
+	ext := strings.ToLower(filepath.Ext(request.Filename))
+	key := joinKey(s.cfg.Environment, s.cfg.DirectUploadPrefix, tenantSegment(tenant), newUUID()+ext)
+	expiresAt := time.Now().Add(s.cfg.DirectUploadExpiry).UTC()
+
+	uploadURL, signed, err := s.repo.PresignPutURL(ctx, key, request.ContentType, request.Size, s.cfg.DirectUploadExpiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %w", err)
+	}
+	headers := make(map[string]string, len(signed))
+	for name := range signed {
+		headers[name] = signed.Get(name)
+	}
+
+	token, err := s.signUploadToken(uploadToken{
+		Key:      key,
+		Filename: path.Base(request.Filename),
+		Tenant:   tenant,
+		Size:     request.Size,
+		Expires:  expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.DirectUploadResponse{
+		UploadURL: uploadURL,
+		Method:    http.MethodPut,
+		Headers:   headers,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// ClaimDirectUpload validates a completion token for the calling tenant and
+// downloads the staged file it refers to
+func (s *ImageService) ClaimDirectUpload(ctx context.Context, tenant string, token string) (*DirectUpload, error) {
+	if s.cfg.DirectUploadKey == "" {
+		return nil, ErrDirectUploadDisabled
+	}
+
+	claims, err := s.parseUploadToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Tenant != tenant {
+		return nil, fmt.Errorf("%w: issued to another caller", ErrInvalidUploadToken)
+	}
+
+	// Read directly rather than through GetFile: the PUT bypasses this
+	// server, so the existence cache may still hold a miss for the key
+	fileBytes, err := s.repo.DownloadFile(ctx, claims.Key)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+	if int64(len(fileBytes)) != claims.Size {
+		return nil, fmt.Errorf("%w: %d bytes stored, %d announced", ErrUploadMismatch, len(fileBytes), claims.Size)
+	}
+
+	return &DirectUpload{Key: claims.Key, Filename: claims.Filename, Bytes: fileBytes}, nil
+}
+
+// FinishDirectUpload removes a processed file from the staging area, which
+// also makes its token unusable
+func (s *ImageService) FinishDirectUpload(ctx context.Context, upload *DirectUpload) error {
+	return s.repo.DeleteFile(ctx, upload.Key)
+}
+
+// signUploadToken encodes a token as base64url(JSON payload) "." hex HMAC-SHA256
+// of the encoded payload, keyed with the direct upload key
+func (s *ImageService) signUploadToken(claims uploadToken) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode upload token: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.uploadTokenSignature(encoded), nil
+}
+
+// parseUploadToken verifies a token's signature and expiry and decodes it
+func (s *ImageService) parseUploadToken(token string) (*uploadToken, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(s.uploadTokenSignature(encoded))) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidUploadToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUploadToken, err)
+	}
+	var claims uploadToken
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUploadToken, err)
+	}
+	if time.Now().Unix() > claims.Expires {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidUploadToken)
+	}
+
+	return &claims, nil
+}
+
+// Helper function to compute the hex signature of an encoded token payload
+func (s *ImageService) uploadTokenSignature(encoded string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.DirectUploadKey))
+	mac.Write([]byte(encoded))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,145 @@
+// internal/service/exif.go
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// exifTimeLayout is how EXIF stores date/time tags
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// Helper function to read the EXIF DateTimeOriginal of an image. EXIF
+// times carry no zone, so the camera's local time is returned as UTC.
+func captureTime(fileBytes []byte) (time.Time, bool) {
+	x, err := exif.Decode(bytes.NewReader(fileBytes))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	tag, err := x.Get(exif.DateTimeOriginal)
+	if err != nil {
+		return time.Time{}, false
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	taken, err := time.Parse(exifTimeLayout, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return taken, true
+}
+
+// Helper function to read the EXIF orientation of an image, 1 (upright)
+// when it has none or it is out of range
+func exifOrientation(fileBytes []byte) int {
+	x, err := exif.Decode(bytes.NewReader(fileBytes))
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	orientation, err := tag.Int(0)
+	if err != nil || orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return orientation
+}
+
+// Helper function to check whether an orientation swaps width and height
+func orientationTransposes(orientation int) bool {
+	return orientation >= 5
+}
+
+// orient turns a decoded image upright for its EXIF orientation: 2 and 4
+// are mirrored, 3 is upside down, 5 and 7 are transposed and 6 and 8 are
+// rotated a quarter turn clockwise and anticlockwise respectively
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	width, height := bounds.Dx(), bounds.Dy()
+
+	outWidth, outHeight := width, height
+	if orientationTransposes(orientation) {
+		outWidth, outHeight = height, width
+	}
+	// Source pixel of each output pixel
+	source := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return width - 1 - x, y },
+		3: func(x, y int) (int, int) { return width - 1 - x, height - 1 - y },
+		4: func(x, y int) (int, int) { return x, height - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return y, height - 1 - x },
+		7: func(x, y int) (int, int) { return width - 1 - y, height - 1 - x },
+		8: func(x, y int) (int, int) { return width - 1 - y, x },
+	}[orientation]
+
+	out := image.NewNRGBA(image.Rect(0, 0, outWidth, outHeight))
+	for y := 0; y < outHeight; y++ {
+		for x := 0; x < outWidth; x++ {
+			sx, sy := source(x, y)
+			copy(out.Pix[out.PixOffset(x, y):out.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):])
+		}
+	}
+	return out
+}
+
+// stripJPEGMetadata removes the EXIF and XMP (APP1) and IPTC (APP13)
+// segments of a JPEG without re-encoding it. The JFIF header, ICC profile
+// and Adobe segment are kept since decoding and colour depend on them. It
+// reports false for a stream it can't walk.
+func stripJPEGMetadata(fileBytes []byte) ([]byte, bool) {
+	if len(fileBytes) < 2 || fileBytes[0] != 0xFF || fileBytes[1] != 0xD8 {
+		return nil, false
+	}
+
+	out := make([]byte, 0, len(fileBytes))
+	out = append(out, fileBytes[:2]...)
+	for i := 2; ; {
+		if i+1 >= len(fileBytes) || fileBytes[i] != 0xFF {
+			return nil, false
+		}
+		marker := fileBytes[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before a marker
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Standalone markers carry no length
+			out = append(out, fileBytes[i:i+2]...)
+			i += 2
+			continue
+		case marker == 0xDA:
+			// Start of scan: the entropy-coded data runs to the end
+			return append(out, fileBytes[i:]...), true
+		}
+
+		if i+3 >= len(fileBytes) {
+			return nil, false
+		}
+		end := i + 2 + int(fileBytes[i+2])<<8 + int(fileBytes[i+3])
+		if end > len(fileBytes) {
+			return nil, false
+		}
+		if marker != 0xE1 && marker != 0xED {
+			out = append(out, fileBytes[i:end]...)
+		}
+		i = end
+	}
+}
@@ -0,0 +1,134 @@
+// internal/service/gif.go
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+
+	"github.com/nfnt/resize"
+)
+
+// Helper function to decode every frame of a GIF; nil for other formats
+// and for single-frame GIFs, which take the still-image path
+func decodeAnimation(fileBytes []byte, format string) (*gif.GIF, error) {
+	if format != "gif" {
+		return nil, nil
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(fileBytes))
+	if err != nil {
+		return nil, err
+	}
+	if len(anim.Image) < 2 {
+		return nil, nil
+	}
+	return anim, nil
+}
+
+// resizeAnimation scales every frame of an animation for a plan. Frames
+// keep their own rectangle on the canvas, palette, delay and disposal
+// method, and the global palette, background and loop count carry over,
+// so partial-frame animations still composite correctly.
+func resizeAnimation(anim *gif.GIF, plan variantPlan) *gif.GIF {
+	canvasWidth, canvasHeight := anim.Config.Width, anim.Config.Height
+	if canvasWidth == 0 || canvasHeight == 0 {
+		bounds := anim.Image[0].Bounds()
+		canvasWidth, canvasHeight = bounds.Max.X, bounds.Max.Y
+	}
+
+	width, height := proportionalSize(plan.spec.Width, plan.spec.Height, canvasWidth, canvasHeight)
+
+	// Cover scales the canvas past the target and crops the overflow around
+	// the centre; pad scales it inside the target and centres it, leaving
+	// the rest to the background
+	scaledWidth, scaledHeight := width, height
+	if plan.fit == FitCover && plan.spec.Width > 0 && plan.spec.Height > 0 {
+		scale := max(float64(width)/float64(canvasWidth), float64(height)/float64(canvasHeight))
+		scaledWidth = max(int(math.Round(float64(canvasWidth)*scale)), width)
+		scaledHeight = max(int(math.Round(float64(canvasHeight)*scale)), height)
+	}
+	if plan.fit == fitPad && plan.spec.Width > 0 && plan.spec.Height > 0 {
+		scaledWidth, scaledHeight = containWithin(canvasWidth, canvasHeight, width, height)
+	}
+	offset := image.Pt((scaledWidth-width)/2, (scaledHeight-height)/2)
+	canvas := image.Rect(0, 0, width, height)
+
+	scaleX := float64(scaledWidth) / float64(canvasWidth)
+	scaleY := float64(scaledHeight) / float64(canvasHeight)
+
+	out := &gif.GIF{
+		Image:           make([]*image.Paletted, len(anim.Image)),
+		Delay:           anim.Delay,
+		LoopCount:       anim.LoopCount,
+		Disposal:        anim.Disposal,
+		BackgroundIndex: anim.BackgroundIndex,
+		Config:          image.Config{ColorModel: anim.Config.ColorModel, Width: width, Height: height},
+	}
+
+	for i, frame := range anim.Image {
+		bounds := frame.Bounds()
+		scaled := image.Rect(
+			int(math.Floor(float64(bounds.Min.X)*scaleX)), int(math.Floor(float64(bounds.Min.Y)*scaleY)),
+			int(math.Ceil(float64(bounds.Max.X)*scaleX)), int(math.Ceil(float64(bounds.Max.Y)*scaleY)),
+		)
+		target := scaled.Sub(offset).Intersect(canvas)
+
+		// A frame cropped away entirely still needs a pixel to carry its delay
+		if target.Empty() {
+			dst := image.NewPaletted(image.Rect(0, 0, 1, 1), frame.Palette)
+			if index, ok := transparentIndex(frame.Palette); ok {
+				dst.Pix[0] = index
+			}
+			out.Image[i] = dst
+			continue
+		}
+
+		resized := resize.Resize(uint(scaled.Dx()), uint(scaled.Dy()), frame, plan.resize)
+		dst := image.NewPaletted(target, frame.Palette)
+		// No dithering: it would shimmer between frames
+		draw.Draw(dst, target, resized, resized.Bounds().Min.Add(target.Min.Add(offset).Sub(scaled.Min)), draw.Src)
+		out.Image[i] = dst
+	}
+
+	return out
+}
+
+// Helper function to find the fully transparent entry of a palette
+func transparentIndex(palette []color.Color) (uint8, bool) {
+	for i, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return uint8(i), true
+		}
+	}
+	return 0, false
+}
+
+// Helper function to note where an animated upload loses its animation
+func animationWarnings(plans []variantPlan, opts UploadOptions) []string {
+	var warnings []string
+	if opts.Brightness != 0 || opts.Contrast != 0 {
+		warnings = append(warnings, "brightness and contrast are not applied to animated GIF output")
+	}
+	if opts.Trim {
+		warnings = append(warnings, "trim is not applied to animated GIF output")
+	}
+	for _, plan := range plans {
+		if plan.format != "gif" {
+			warnings = append(warnings, fmt.Sprintf("%dx%d %s uses the first frame of the animation",
+				plan.spec.Width, plan.spec.Height, plan.format))
+		}
+	}
+	return warnings
+}
+
+// Helper function to encode an animation
+func encodeAnimation(anim *gif.GIF) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, anim)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,33 @@
+// internal/service/histogram.go
+package service
+
+import (
+	"image"
+	"image/draw"
+
+	"image-upload-server/internal/models"
+)
+
+// histogram counts the pixels of each 8-bit value per channel. Colours are
+// taken unpremultiplied, so a transparent pixel still counts its colour.
+func histogram(img image.Image) *models.Histogram {
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		bounds := img.Bounds()
+		nrgba = image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	h := &models.Histogram{}
+	bounds := nrgba.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := nrgba.Pix[nrgba.PixOffset(bounds.Min.X, y):nrgba.PixOffset(bounds.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			h.Red[row[i]]++
+			h.Green[row[i+1]]++
+			h.Blue[row[i+2]]++
+			h.Alpha[row[i+3]]++
+		}
+	}
+	return h
+}
@@ -0,0 +1,187 @@
+// internal/service/jobs.go
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"image-upload-server/internal/models"
+)
+
+// Upload job states
+const (
+	JobProcessing = "processing"
+	JobFinished   = "finished"
+	JobFailed     = "failed"
+)
+
+// ErrAsyncDisabled is returned when an asynchronous upload is requested but not enabled
+var ErrAsyncDisabled = errors.New("asynchronous uploads are disabled")
+
+// ErrJobNotFound is returned for unknown, expired or other tenants' jobs
+var ErrJobNotFound = errors.New("upload job not found")
+
+// uploadJob is one asynchronous upload and, once done, its outcome
+type uploadJob struct {
+	tenant   string
+	status   models.UploadJob
+	response *models.UploadResponse
+	err      error
+}
+
+// uploadJobs tracks the asynchronous uploads of a server in memory
+type uploadJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*uploadJob
+	// running counts the jobs still processing, for WaitForJobs
+	running sync.WaitGroup
+	// average is a moving average of how long jobs take, for estimates
+	// before a job has progress of its own
+	average time.Duration
+}
+
+// StartUploadJob processes an upload like ProcessAndUploadImage, but in the
+// background, and returns the job to poll with UploadJob. Warnings are
+// added to the response once it succeeds, like those a caller adds to a
+// synchronous one.
+func (s *ImageService) StartUploadJob(
+	ctx context.Context,
+	fileBytes []byte,
+	filename string,
+	compressSizes []models.CompressSpec,
+	opts UploadOptions,
+	warnings []string,
+) (models.UploadJob, error) {
+	if !s.cfg.AsyncUploads {
+		return models.UploadJob{}, ErrAsyncDisabled
+	}
+
+	var id [16]byte
+	rand.Read(id[:])
+	job := &uploadJob{
+		tenant: opts.Tenant,
+		status: models.UploadJob{
+			ID:        hex.EncodeToString(id[:]),
+			State:     JobProcessing,
+			StartedAt: time.Now().UTC(),
+		},
+	}
+
+	s.jobs.mu.Lock()
+	s.pruneJobs()
+	s.jobs.jobs[job.status.ID] = job
+	status := s.jobStatus(job)
+	s.jobs.mu.Unlock()
+
+	opts.Progress = func(done, total int) {
+		s.jobs.mu.Lock()
+		job.status.CompletedSizes, job.status.TotalSizes = done, total
+		s.jobs.mu.Unlock()
+	}
+
+	// The job outlives the request that started it, but keeps its values,
+	// such as the request ID, for logging
+	s.jobs.running.Add(1)
+	go s.runUploadJob(context.WithoutCancel(ctx), job, fileBytes, filename, compressSizes, opts, warnings)
+	return status, nil
+}
+
+// WaitForJobs waits until no asynchronous upload is running, for a
+// graceful shutdown, or returns ctx's error if it is done first
+func (s *ImageService) WaitForJobs(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.jobs.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// UploadJob returns a job's progress and, once it is done, the upload
+// response or the error it failed with. Jobs are only visible to the tenant
+// that started them.
+func (s *ImageService) UploadJob(tenant string, id string) (models.UploadJob, *models.UploadResponse, error) {
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+
+	s.pruneJobs()
+	job, ok := s.jobs.jobs[id]
+	if !ok || job.tenant != tenant {
+		return models.UploadJob{}, nil, ErrJobNotFound
+	}
+	return s.jobStatus(job), job.response, job.err
+}
+
+// runUploadJob processes a job's upload and records the outcome
+func (s *ImageService) runUploadJob(ctx context.Context, job *uploadJob, fileBytes []byte, filename string, compressSizes []models.CompressSpec, opts UploadOptions, warnings []string) {
+	defer s.jobs.running.Done()
+	response, err := s.ProcessAndUploadImage(ctx, fileBytes, filename, compressSizes, opts)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Asynchronous upload failed", "job", job.status.ID, "filename", filename, "error", err)
+	} else {
+		response.Warnings = append(response.Warnings, warnings...)
+	}
+
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+	finished := time.Now().UTC()
+	job.status.FinishedAt = &finished
+	job.response, job.err = response, err
+	if err != nil {
+		job.status.State = JobFailed
+		return
+	}
+	job.status.State = JobFinished
+
+	// Weigh recent jobs more, as load and image mix change
+	elapsed := finished.Sub(job.status.StartedAt)
+	if s.jobs.average == 0 {
+		s.jobs.average = elapsed
+	} else {
+		s.jobs.average = (4*s.jobs.average + elapsed) / 5
+	}
+}
+
+// jobStatus returns a copy of a job's progress with its estimated
+// completion: extrapolated from the sizes done so far, or from the
+// average job before the first is done. Called with the jobs lock held.
+func (s *ImageService) jobStatus(job *uploadJob) models.UploadJob {
+	status := job.status
+	if status.State != JobProcessing {
+		return status
+	}
+
+	var estimate time.Duration
+	switch {
+	case status.CompletedSizes > 0 && status.TotalSizes > 0:
+		elapsed := time.Since(status.StartedAt)
+		estimate = elapsed * time.Duration(status.TotalSizes) / time.Duration(status.CompletedSizes)
+	case s.jobs.average > 0:
+		estimate = s.jobs.average
+	default:
+		return status
+	}
+	completion := status.StartedAt.Add(estimate)
+	status.EstimatedCompletion = &completion
+	return status
+}
+
+// pruneJobs forgets jobs that finished longer than the retention ago.
+// Called with the jobs lock held.
+func (s *ImageService) pruneJobs() {
+	cutoff := time.Now().Add(-s.cfg.AsyncJobRetention)
+	for id, job := range s.jobs.jobs {
+		if job.status.FinishedAt != nil && job.status.FinishedAt.Before(cutoff) {
+			delete(s.jobs.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// internal/service/listing.go
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"image-upload-server/internal/models"
+)
+
+// Supported listing sort keys and orders
+const (
+	ListSortName     = "name"
+	ListSortSize     = "size"
+	ListSortModified = "modified"
+
+	ListOrderAsc  = "asc"
+	ListOrderDesc = "desc"
+)
+
+// ListOptions controls how a listing is sorted and truncated
+type ListOptions struct {
+	// Collection restricts the listing to one collection of the namespace
+	Collection string
+	// Prefix further restricts the listing to keys starting with it, relative
+	// to the namespace, e.g. "products/sh"
+	Prefix string
+	// Token continues a key-ordered listing where the previous page ended
+	Token string
+	// Sort is name, size or modified; empty keeps the storage order (by key)
+	Sort string
+	// Order is asc or desc; empty is ascending
+	Order string
+	// Limit caps the number of entries returned after sorting; zero returns all
+	Limit int
+	// AllEnvironments lists past the configured environment, from the bucket
+	// root with Prefix relative to it; not available within a tenant namespace
+	AllEnvironments bool
+}
+
+// Helper function to reject unknown sort keys, orders and negative limits
+func (o ListOptions) validate() error {
+	switch o.Sort {
+	case "", ListSortName, ListSortSize, ListSortModified:
+	default:
+		return fmt.Errorf("%w: unsupported sort %q, expected name, size or modified", ErrInvalidQuery, o.Sort)
+	}
+	switch o.Order {
+	case "", ListOrderAsc, ListOrderDesc:
+	default:
+		return fmt.Errorf("%w: unsupported order %q, expected asc or desc", ErrInvalidQuery, o.Order)
+	}
+	if o.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidQuery)
+	}
+	if o.Token != "" && !o.keyOrdered() {
+		return fmt.Errorf("%w: token only applies to listings in ascending key order", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// keyOrdered reports whether the listing is in the storage order, by key
+func (o ListOptions) keyOrdered() bool {
+	return (o.Sort == "" || o.Sort == ListSortName) && o.Order != ListOrderDesc
+}
+
+// paged reports whether the listing is read a page at a time
+func (o ListOptions) paged() bool {
+	return o.keyOrdered() && (o.Limit > 0 || o.Token != "")
+}
+
+// sortListing orders a listing in place; ties fall back to the key so the
+// result is stable across calls
+func sortListing(images []models.ListedImage, opts ListOptions) {
+	if opts.Sort == "" && opts.Order != ListOrderDesc {
+		return
+	}
+
+	compare := func(a, b models.ListedImage) int {
+		var c int
+		switch opts.Sort {
+		case ListSortSize:
+			c = cmp.Compare(a.Size, b.Size)
+		case ListSortModified:
+			c = a.LastModified.Compare(b.LastModified)
+		}
+		return cmp.Or(c, strings.Compare(a.Key, b.Key))
+	}
+	if opts.Order == ListOrderDesc {
+		slices.SortFunc(images, func(a, b models.ListedImage) int { return compare(b, a) })
+		return
+	}
+	slices.SortFunc(images, compare)
+}
@@ -0,0 +1,289 @@
+// internal/service/naming.go
+package service
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Name collision handling modes
+const (
+	NameCollisionWarn  = "warn"
+	NameCollisionError = "error"
+)
+
+// ErrNameCollision is returned when an image with the same name already exists and collisions are errors
+var ErrNameCollision = errors.New("an image with the same name already exists")
+
+// Object key naming strategies
+const (
+	KeyNamingTimestamp = "timestamp" // name_1700000000000000000.jpg
+	KeyNamingUUID      = "uuid"      // name_5f0c6a3e-....jpg
+	KeyNamingSuffix    = "suffix"    // name.jpg, then name-1.jpg on collision
+	KeyNamingContent   = "content"   // <sha256>.jpg, the same key for the same bytes; variants are <sha256>_WxH-<settings>.jpg
+)
+
+// ErrKeyConflict is returned when suffix naming runs out of attempts
+var ErrKeyConflict = errors.New("no free object key")
+
+// uuidPattern matches the tokens generated for uuid naming
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// keyName is the naming of one upload: a stem shared by the original and its
+// variants, and an optional unique token placed after the size
+type keyName struct {
+	stem   string
+	token  string
+	ext    string
+	source string // Uploaded name without its extension, for download filenames
+}
+
+// original returns the original's file name, e.g. "photo_<token>.jpg"
+func (n keyName) original() string {
+	return n.stem + n.tokenPart() + n.ext
+}
+
+// variant returns a variant's file name, e.g. "photo_600x400_<token>.webp",
+// or "photo_600x400-3f9a1c2b_<token>.webp" with a collision tag
+func (n keyName) variant(width, height int, tag string, ext string) string {
+	size := fmt.Sprintf("%dx%d", width, height)
+	if tag != "" {
+		size += "-" + tag
+	}
+	return n.stem + "_" + size + n.tokenPart() + ext
+}
+
+// Helper function to get the token with its separator
+func (n keyName) tokenPart() string {
+	if n.token == "" {
+		return ""
+	}
+	return "_" + n.token
+}
+
+// Helper function to get the extension an upload is stored with. The decoded
+// format is authoritative; a mislabelled file gets its real extension.
+func uploadExtension(filename string, format string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if labelled, _ := normalizeFormat(strings.TrimPrefix(ext, ".")); labelled != format {
+		ext = formatExtension(format)
+	}
+	return ext
+}
+
+// newKeyName names an upload with the configured strategy. Suffix naming
+// checks candidates with HeadObject, so two concurrent uploads of the same
+// name can still race for the same key.
+func (s *ImageService) newKeyName(ctx context.Context, filename string, format string, opts UploadOptions) (keyName, error) {
+	name := keyName{stem: strings.TrimSuffix(filename, filepath.Ext(filename)), ext: uploadExtension(filename, format)}
+	name.source = name.stem
+
+	switch s.cfg.KeyNaming {
+	case KeyNamingContent:
+		name.stem = opts.ContentSHA256
+	case KeyNamingUUID:
+		name.token = newUUID()
+	case KeyNamingSuffix:
+		stem := name.stem
+		for attempt := 0; ; attempt++ {
+			if attempt > 0 {
+				name.stem = fmt.Sprintf("%s-%d", stem, attempt)
+			}
+			if _, err := s.repo.GetFile(ctx, s.objectKey(format, opts, name.original())); err != nil {
+				if isContextError(err) {
+					return keyName{}, err
+				}
+				return name, nil
+			}
+			if attempt >= s.cfg.KeySuffixMaxAttempts {
+				return keyName{}, fmt.Errorf("%w for %s after %d attempts", ErrKeyConflict, filename, attempt+1)
+			}
+		}
+	default:
+		name.token = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+
+	return name, nil
+}
+
+// nameCollision looks for an original that was uploaded under the same name
+// and lands under the same prefix, returning its key. Keys differing only
+// by their unique token (or, with suffix naming, by being exactly the
+// name) count as the same name.
+func (s *ImageService) nameCollision(ctx context.Context, filename string, format string, opts UploadOptions) (string, error) {
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	prefix := s.objectKey(format, opts, stem)
+	dir := strings.TrimSuffix(prefix, path.Base(prefix))
+
+	files, err := s.repo.ListFiles(ctx, prefix)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		rest := strings.TrimPrefix(file.Key, dir)
+		if strings.Contains(rest, "/") {
+			continue
+		}
+		base := strings.TrimSuffix(rest, filepath.Ext(rest))
+		if strings.TrimSuffix(base, s.tokenSuffix(base)) == path.Base(stem) && s.isOriginalKey(file.Key) {
+			return file.Key, nil
+		}
+	}
+	return "", nil
+}
+
+// downloadFilename renders the configured download filename template for an
+// image, e.g. "{name}-{width}x{height}{ext}" becomes "photo-600x400.jpg"
+func (s *ImageService) downloadFilename(source string, width, height int, ext string) string {
+	return strings.NewReplacer(
+		"{name}", sanitizeFilename(path.Base(source)),
+		"{width}", strconv.Itoa(width),
+		"{height}", strconv.Itoa(height),
+		"{ext}", ext,
+	).Replace(s.cfg.DownloadFilenameTemplate)
+}
+
+// DownloadFilename derives a stored image's download filename from its key,
+// dropping the folder and the unique token
+func (s *ImageService) DownloadFilename(key string) string {
+	return s.downloadFilename(s.downloadNameParts(key))
+}
+
+// Helper function to split a key into the parts of its download filename:
+// the source name, the WxH of a variant (zero for an original) and the
+// extension
+func (s *ImageService) downloadNameParts(key string) (base string, width int, height int, ext string) {
+	ext = filepath.Ext(key)
+	base = strings.TrimSuffix(path.Base(key), ext)
+
+	if s.tokenNaming() {
+		if idx := strings.LastIndex(base, "_"); idx >= 0 && s.validToken(base[idx+1:]) {
+			base = base[:idx]
+		}
+	}
+
+	if idx := strings.LastIndex(base, "_"); idx >= 0 {
+		if _, err := fmt.Sscanf(base[idx+1:], "%dx%d", &width, &height); err == nil {
+			base = base[:idx]
+		} else {
+			width, height = 0, 0
+		}
+	}
+	return base, width, height, ext
+}
+
+// variantKeys finds the stored variants of an original: the sizes made at
+// upload, e.g. "photo_600x400_<token>.webp" next to "photo_<token>.jpg",
+// and on-demand variants cached under "photo_<token>/"
+func (s *ImageService) variantKeys(ctx context.Context, original string) ([]string, error) {
+	dir := path.Dir(original)
+	if dir == "." {
+		dir = ""
+	} else {
+		dir += "/"
+	}
+	base := strings.TrimSuffix(path.Base(original), filepath.Ext(original))
+
+	tokenPart := s.tokenSuffix(base)
+	stem := strings.TrimSuffix(base, tokenPart)
+	sized := regexp.MustCompile(`^` + regexp.QuoteMeta(stem) + `_\d+x\d+(-[0-9a-f]{8})?` + regexp.QuoteMeta(tokenPart) + `\.[A-Za-z0-9]+$`)
+
+	var keys []string
+	files, err := s.repo.ListFiles(ctx, dir+stem+"_")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if sized.MatchString(strings.TrimPrefix(file.Key, dir)) {
+			keys = append(keys, file.Key)
+		}
+	}
+
+	cached, err := s.repo.ListFiles(ctx, dir+base+"/")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range cached {
+		keys = append(keys, file.Key)
+	}
+
+	return keys, nil
+}
+
+// Helper function to rename an upload-time variant of original to sit next
+// to the original's new key, keeping its size segment, e.g. moving
+// "a/photo_<token>.jpg" to "b/cover.jpg" renames "a/photo_600x400_<token>.webp"
+// to "b/cover_600x400.webp", where variantKeys finds it for the new key
+func (s *ImageService) movedVariantKey(original string, variant string, destination string) string {
+	base := strings.TrimSuffix(path.Base(original), filepath.Ext(original))
+	tokenPart := s.tokenSuffix(base)
+	stem := strings.TrimSuffix(base, tokenPart)
+
+	ext := filepath.Ext(variant)
+	size := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(path.Base(variant), stem), ext), tokenPart)
+
+	newBase := strings.TrimSuffix(path.Base(destination), filepath.Ext(destination))
+	newTokenPart := s.tokenSuffix(newBase)
+	newStem := strings.TrimSuffix(newBase, newTokenPart)
+
+	dir := path.Dir(destination)
+	if dir == "." {
+		dir = ""
+	}
+	return joinKey(dir, newStem+size+newTokenPart+ext)
+}
+
+// Helper function to get the "_<token>" ending of a key's base name, if
+// the configured naming adds one
+func (s *ImageService) tokenSuffix(base string) string {
+	if !s.tokenNaming() {
+		return ""
+	}
+	if idx := strings.LastIndex(base, "_"); idx >= 0 && s.validToken(base[idx+1:]) {
+		return base[idx:]
+	}
+	return ""
+}
+
+// Helper function to check whether the configured naming adds a unique token
+func (s *ImageService) tokenNaming() bool {
+	return s.cfg.KeyNaming != KeyNamingSuffix && s.cfg.KeyNaming != KeyNamingContent
+}
+
+// Helper function to replace characters that are unsafe in a saved filename
+func sanitizeFilename(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+	return cmp.Or(strings.Trim(safe, "."), "image")
+}
+
+// Helper function to check a token was generated by the configured strategy
+func (s *ImageService) validToken(token string) bool {
+	if s.cfg.KeyNaming == KeyNamingUUID {
+		return uuidPattern.MatchString(token)
+	}
+	return uploadTimeFromKey("_"+token) != nil
+}
+
+// Helper function to generate a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,91 @@
+// internal/service/pipeline.go
+package service
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Stages of the pipeline run on the decoded image before resizing
+const (
+	StageTrim       = "trim"       // Crop uniform borders, with UploadOptions.Trim
+	StageContrast   = "contrast"   // Scale around mid-grey, with UploadOptions.Contrast
+	StageBrightness = "brightness" // Shift the channels, with UploadOptions.Brightness
+)
+
+// ValidatePipeline checks a configured stage order: every stage must be
+// known and listed once. Stages left out are never applied.
+func ValidatePipeline(stages []string) error {
+	seen := make(map[string]bool, len(stages))
+	for _, stage := range stages {
+		switch stage {
+		case StageTrim, StageContrast, StageBrightness:
+		default:
+			return fmt.Errorf("unknown pipeline stage %q: use %s, %s or %s", stage, StageTrim, StageContrast, StageBrightness)
+		}
+		if seen[stage] {
+			return fmt.Errorf("pipeline stage %q is listed twice", stage)
+		}
+		seen[stage] = true
+	}
+	return nil
+}
+
+// runPipeline applies the stages the request asks for, in the configured
+// order, and returns the result with any warnings. Neighbouring tone
+// stages are merged into one pass over the pixels, timed as "adjust".
+func (s *ImageService) runPipeline(img image.Image, opts UploadOptions, timings *stageTimings) (image.Image, []string) {
+	var warnings []string
+	var curves []toneCurve
+	flush := func() {
+		if len(curves) == 0 {
+			return
+		}
+		doneAdjust := timings.track("adjust")
+		img = applyCurves(img, curves)
+		doneAdjust()
+		curves = nil
+	}
+
+	applied := make(map[string]bool, len(s.cfg.Pipeline))
+	for _, stage := range s.cfg.Pipeline {
+		applied[stage] = true
+		switch stage {
+		case StageTrim:
+			if !opts.Trim {
+				continue
+			}
+			flush()
+			doneTrim := timings.track(StageTrim)
+			var trimmed bool
+			img, trimmed = trimBorders(img, opts.TrimTolerance)
+			doneTrim()
+			if !trimmed {
+				warnings = append(warnings, "trim skipped: the image is a single uniform colour")
+			}
+		case StageContrast:
+			if opts.Contrast != 0 {
+				curves = append(curves, contrastCurve(opts.Contrast))
+			}
+		case StageBrightness:
+			if opts.Brightness != 0 {
+				curves = append(curves, brightnessCurve(opts.Brightness))
+			}
+		}
+	}
+	flush()
+
+	// A requested stage the deployment left out is reported, not an error
+	requested := map[string]bool{StageTrim: opts.Trim, StageContrast: opts.Contrast != 0, StageBrightness: opts.Brightness != 0}
+	var missing []string
+	for _, stage := range []string{StageTrim, StageContrast, StageBrightness} {
+		if requested[stage] && !applied[stage] {
+			missing = append(missing, stage)
+		}
+	}
+	if len(missing) > 0 {
+		warnings = append(warnings, strings.Join(missing, ", ")+" not applied: not in the server's pipeline")
+	}
+	return img, warnings
+}
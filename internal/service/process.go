@@ -0,0 +1,117 @@
+// internal/service/process.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"image-upload-server/internal/models"
+)
+
+// ProcessedImage is a variant rendered for the response instead of being stored
+type ProcessedImage struct {
+	models.ImageResult // Dimensions, format and quality; URL and Key stay empty
+	ContentType        string
+	Bytes              []byte
+}
+
+// ProcessResult holds the variants of a process-only request
+type ProcessResult struct {
+	SourceWidth  int
+	SourceHeight int
+	Images       []ProcessedImage
+	FailedSizes  []models.FailedSize
+	Warnings     []string
+}
+
+// ProcessImage runs an image through the same decoding, adjustments and
+// variant planning as ProcessAndUploadImage, but returns the encoded
+// variants instead of storing them. Nothing is written to S3; the original
+// is not part of the result.
+func (s *ImageService) ProcessImage(
+	ctx context.Context,
+	fileBytes []byte,
+	filename string,
+	compressSizes []models.CompressSpec,
+	opts UploadOptions,
+) (result *ProcessResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.ErrorContext(ctx, "Recovered from panic while processing", "filename", filename, "panic", r, "stack", string(debug.Stack()))
+			result, err = nil, fmt.Errorf("%w: %v", ErrProcessingPanic, r)
+		}
+	}()
+
+	timings := newStageTimings()
+	defer s.warnIfSlow(ctx, timings, filename, len(fileBytes), compressSizes)
+
+	if s.cfg.ProcessingTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, s.cfg.ProcessingTimeout, ErrProcessingTimeout)
+		defer cancel()
+		defer func() {
+			if err != nil && errors.Is(context.Cause(ctx), ErrProcessingTimeout) {
+				result, err = nil, fmt.Errorf("%w: stopped after %s", ErrProcessingTimeout, s.cfg.ProcessingTimeout)
+			}
+		}()
+	}
+
+	source, release, err := s.prepareImage(ctx, fileBytes, filename, compressSizes, opts, timings)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if len(source.plans) == 0 {
+		return nil, fmt.Errorf("%w: no size is left to process: %s", ErrInvalidSpec, strings.Join(source.warnings, "; "))
+	}
+
+	ext := uploadExtension(filename, source.format)
+	sourceName := strings.TrimSuffix(filename, filepath.Ext(filename))
+	images := make([]ProcessedImage, len(source.plans))
+	errs := make([]error, len(source.plans))
+	s.runVariants(len(source.plans), func(i int) {
+		if errs[i] = ctx.Err(); errs[i] != nil {
+			return
+		}
+		plan := source.plans[i]
+		encoded, variantExt, err := s.renderVariant(ctx, plan, source, ext, timings)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		images[i] = ProcessedImage{
+			ImageResult: s.variantResult(plan, sourceName, variantExt),
+			ContentType: getContentType(plan.format),
+			Bytes:       encoded,
+		}
+	})
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("failed to process compressed images: %w", ctx.Err())
+	}
+
+	result = &ProcessResult{
+		SourceWidth:  source.bounds.Dx(),
+		SourceHeight: source.bounds.Dy(),
+		Warnings:     s.warnings(source.warnings, source.plans, false),
+	}
+	for i, plan := range source.plans {
+		switch {
+		case errs[i] == nil:
+			result.Images = append(result.Images, images[i])
+		case errors.Is(errs[i], ErrProcessingPanic):
+			return nil, errs[i]
+		default:
+			result.FailedSizes = append(result.FailedSizes, failedSize(plan, errs[i]))
+		}
+	}
+	if compare := resultOrder(source.order); compare != nil {
+		slices.SortStableFunc(result.Images, func(a, b ProcessedImage) int { return compare(a.ImageResult, b.ImageResult) })
+	}
+
+	return result, nil
+}
@@ -0,0 +1,81 @@
+// internal/service/queue.go
+package service
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBusy is returned when an upload can't get a processing slot in time
+var ErrBusy = errors.New("server is busy")
+
+// processingQueue bounds how many images are processed at once. Callers
+// beyond the worker count wait in line, up to a maximum depth and wait time.
+type processingQueue struct {
+	slots   chan struct{}
+	depth   int64
+	timeout time.Duration
+	waiting atomic.Int64
+}
+
+// newProcessingQueue creates a queue, or nil when workers is not positive
+func newProcessingQueue(workers int, depth int, timeout time.Duration) *processingQueue {
+	if workers <= 0 {
+		return nil
+	}
+
+	q := &processingQueue{
+		slots:   make(chan struct{}, workers),
+		depth:   int64(depth),
+		timeout: timeout,
+	}
+	expvar.Publish("processing_queue", expvar.Func(func() any {
+		return map[string]int64{
+			"workers": int64(cap(q.slots)),
+			"busy":    int64(len(q.slots)),
+			"waiting": q.waiting.Load(),
+			"depth":   q.depth,
+		}
+	}))
+
+	return q
+}
+
+// acquire waits for a processing slot, giving up early when ctx is done;
+// call the returned function to release it
+func (q *processingQueue) acquire(ctx context.Context) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+
+	release := func() { <-q.slots }
+
+	// Take a free slot without queueing
+	select {
+	case q.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if q.waiting.Add(1) > q.depth {
+		q.waiting.Add(-1)
+		return nil, fmt.Errorf("%w: processing queue is full", ErrBusy)
+	}
+	defer q.waiting.Add(-1)
+
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+
+	select {
+	case q.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: timed out waiting for a processing slot", ErrBusy)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
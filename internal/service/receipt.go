@@ -0,0 +1,66 @@
+// internal/service/receipt.go
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"image-upload-server/internal/models"
+)
+
+// receiptAlgorithm identifies the receipt signing scheme
+const receiptAlgorithm = "HMAC-SHA256-v1"
+
+// signReceipt attaches a receipt to an upload response when a signing key is configured
+func (s *ImageService) signReceipt(response *models.UploadResponse) {
+	if s.cfg.ReceiptKey == "" {
+		return
+	}
+
+	issuedAt := time.Now().UTC()
+	response.Receipt = &models.UploadReceipt{
+		Algorithm: receiptAlgorithm,
+		IssuedAt:  issuedAt,
+		Signature: s.receiptSignature(response, issuedAt),
+	}
+}
+
+// VerifyReceipt reports whether a response's receipt was issued by this
+// server for exactly these images
+func (s *ImageService) VerifyReceipt(response *models.UploadResponse) bool {
+	receipt := response.Receipt
+	if s.cfg.ReceiptKey == "" || receipt == nil || receipt.Algorithm != receiptAlgorithm {
+		return false
+	}
+
+	expected := s.receiptSignature(response, receipt.IssuedAt)
+	return hmac.Equal([]byte(expected), []byte(receipt.Signature))
+}
+
+// receiptSignature is the hex HMAC-SHA256, keyed with the receipt key, of
+//
+//	HMAC-SHA256-v1
+//	<issued_at, RFC 3339 with nanoseconds, UTC>
+//	<url> <width>x<height> <format>   (the original image)
+//	<url> <width>x<height> <format>   (one line per compressed image, in order)
+//
+// with lines joined by "\n"
+func (s *ImageService) receiptSignature(response *models.UploadResponse, issuedAt time.Time) string {
+	lines := []string{receiptAlgorithm, issuedAt.UTC().Format(time.RFC3339Nano), receiptLine(response.OriginalImage)}
+	for _, result := range response.CompressedImages {
+		lines = append(lines, receiptLine(result))
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.cfg.ReceiptKey))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Helper function to format one image of a receipt
+func receiptLine(result models.ImageResult) string {
+	return fmt.Sprintf("%s %dx%d %s", result.URL, result.Width, result.Height, result.Format)
+}
@@ -3,162 +3,1347 @@ package service
 
 import (
 	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
-	"log"
+	"io"
+	"log/slog"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/nfnt/resize"
+	"github.com/chai2010/webp"
 
+	"image-upload-server/internal/cdn"
+	"image-upload-server/internal/config"
 	"image-upload-server/internal/models"
 	"image-upload-server/internal/repository"
 )
 
+// ErrInvalidSpec is returned when a compression spec can't be honoured
+var ErrInvalidSpec = errors.New("invalid compression spec")
+
+// ErrImageNotFound is returned when the requested object doesn't exist
+var ErrImageNotFound = errors.New("image not found")
+
+// ErrImageTooSmall is returned when an upload is below the minimum source dimensions
+var ErrImageTooSmall = errors.New("image is too small")
+
+// ErrInvalidQuery is returned when listing parameters are malformed
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ErrStorageAccessDenied is returned when storage refuses the server access to an object
+var ErrStorageAccessDenied = errors.New("storage access denied")
+
+// Helper function to report a failed lookup as ErrImageNotFound when the
+// object is missing, or as ErrStorageAccessDenied when the credentials
+// can't read it; other failures, such as a cancelled request, are kept
+func lookupError(err error) error {
+	switch {
+	case isContextError(err):
+		return err
+	case repository.IsNotFound(err):
+		return ErrImageNotFound
+	case repository.IsAccessDenied(err):
+		return fmt.Errorf("%w: %v", ErrStorageAccessDenied, err)
+	default:
+		return fmt.Errorf("storage lookup failed: %w", err)
+	}
+}
+
+// Helper function to check whether an error comes from a done context
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// ErrProcessingPanic is returned when decoding or resizing panicked
+var ErrProcessingPanic = errors.New("image processing failed unexpectedly")
+
+// ErrDestinationExists is returned when a move would replace an existing object
+var ErrDestinationExists = errors.New("destination already exists")
+
+// ErrProcessingTimeout is returned when an upload runs past the configured processing timeout
+var ErrProcessingTimeout = errors.New("image processing took too long")
+
 // ImageService handles image processing and storage
 type ImageService struct {
-	repo *repository.S3Repository
+	repo     repository.Storage
+	cfg      config.ImageConfig
+	cdn      cdn.Invalidator
+	queue    *processingQueue
+	backfill *backfillJob
+	jobs     *uploadJobs
+	logger   *slog.Logger
 }
 
-// NewImageService creates a new image service
-func NewImageService(repo *repository.S3Repository) *ImageService {
+// cdnInvalidationTimeout bounds a background CDN invalidation
+const cdnInvalidationTimeout = 30 * time.Second
+
+// NewImageService creates a new image service; invalidator may be nil when no CDN is configured
+func NewImageService(repo repository.Storage, cfg config.ImageConfig, invalidator cdn.Invalidator, logger *slog.Logger) *ImageService {
+	for name, profile := range cfg.Profiles {
+		if _, ok := resizeAlgorithm(profile.Resize); !ok {
+			logger.Warn("Unknown resize algorithm in profile, using the server's", "profile", name, "resize", profile.Resize)
+		}
+	}
+	if _, ok := pngCompressionLevel(cfg.PNGCompression); !ok {
+		logger.Warn("Unknown IMAGE_PNG_COMPRESSION, using default", "compression", cfg.PNGCompression)
+	}
+	if _, ok := resizeAlgorithm(cfg.ResizeAlgorithm); !ok {
+		logger.Warn("Unknown IMAGE_RESIZE_ALGORITHM, using lanczos3", "resize", cfg.ResizeAlgorithm)
+	}
+	switch strings.ToLower(cfg.ExtremeAspectPolicy) {
+	case AspectPolicyCrop, AspectPolicyPad, AspectPolicySkip:
+	default:
+		logger.Warn("Unknown extreme aspect ratio policy, using crop", "policy", cfg.ExtremeAspectPolicy)
+	}
+
 	return &ImageService{
-		repo: repo,
+		repo:     repo,
+		cfg:      cfg,
+		cdn:      invalidator,
+		queue:    newProcessingQueue(cfg.Workers, cfg.QueueDepth, cfg.QueueTimeout),
+		backfill: &backfillJob{},
+		jobs:     &uploadJobs{jobs: make(map[string]*uploadJob)},
+		logger:   logger,
 	}
 }
 
+// UploadOptions holds per-request settings for ProcessAndUploadImage
+type UploadOptions struct {
+	// Tenant is the authenticated caller; when set, every key is namespaced under it
+	Tenant string
+	// Collection is a single key segment set by trusted callers, placed right
+	// after the tenant so listings can be scoped to it
+	Collection string
+	// Folder is an optional caller-chosen sub-path, e.g. "products/shoes"
+	Folder string
+	// Format is the default output format for specs without their own; empty keeps the source format
+	Format string
+	// ContentSHA256 is the hex SHA-256 of the upload when the caller already
+	// computed it, e.g. to verify a client checksum; empty computes it here
+	ContentSHA256 string
+	// Quality is the default JPEG and lossy WebP quality for specs without
+	// their own, ahead of the profile and server defaults; zero leaves it unset
+	Quality int
+	// SaveData lowers the quality of lossy variants by the configured
+	// reduction, for clients on slow or metered connections
+	SaveData bool
+	// Lossless selects lossless encoding for WebP specs that don't set their own
+	Lossless bool
+	// PNGCompression is the compression level of PNG output, one of the
+	// PNGCompression constants; empty or unknown uses the server's
+	PNGCompression string
+	// Profile names the configured processing profile whose defaults apply
+	Profile string
+	// Preset names a size set of the profile, used when no specs are given
+	Preset string
+	// Debug adds processing diagnostics to the response
+	Debug bool
+	// Histogram adds the per-channel histogram of the decoded source
+	Histogram bool
+	// StorageClass overrides the configured storage class for the original,
+	// VariantStorageClass for the compressed images
+	StorageClass        string
+	VariantStorageClass string
+	// Sort orders the compressed images (request, area_asc or area_desc); empty uses the configured default
+	Sort string
+	// Brightness and Contrast adjust the decoded image before resizing, in
+	// percent from -100 to 100; zero leaves it untouched
+	Brightness float64
+	Contrast   float64
+	// Trim crops uniform borders off the decoded image before resizing;
+	// TrimTolerance is how far, in percent of full scale, a border pixel
+	// may stray from the corner colour
+	Trim          bool
+	TrimTolerance float64
+	// Progress, when set, is called with the number of compressed sizes done
+	// out of the total, once they are planned and after each one finishes
+	Progress func(done, total int)
+
+	// partition is the date segment of the keys, set while processing
+	partition string
+}
+
 // ProcessAndUploadImage processes an image and uploads it to S3
 func (s *ImageService) ProcessAndUploadImage(
+	ctx context.Context,
 	fileBytes []byte,
 	filename string,
 	compressSizes []models.CompressSpec,
-) (*models.UploadResponse, error) {
-	// Decode the image
-	img, format, err := decodeImage(fileBytes)
+	opts UploadOptions,
+) (response *models.UploadResponse, err error) {
+	// Some malformed inputs make decoders or the resizer panic instead of
+	// returning an error; turn that into a failed request, not a crash
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.ErrorContext(ctx, "Recovered from panic while processing", "filename", filename, "panic", r, "stack", string(debug.Stack()))
+			response, err = nil, fmt.Errorf("%w: %v", ErrProcessingPanic, r)
+		}
+	}()
+
+	timings := newStageTimings()
+	defer s.warnIfSlow(ctx, timings, filename, len(fileBytes), compressSizes)
+
+	// Bound the whole upload
+	if s.cfg.ProcessingTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, s.cfg.ProcessingTimeout, ErrProcessingTimeout)
+		defer cancel()
+	}
+	// Once the deadline passes or the client goes away, remaining sizes are
+	// skipped and whatever was already stored is removed again
+	var stored []string
+	defer func() {
+		if err == nil || ctx.Err() == nil {
+			return
+		}
+		s.removeStored(context.WithoutCancel(ctx), stored)
+		if errors.Is(context.Cause(ctx), ErrProcessingTimeout) {
+			response, err = nil, fmt.Errorf("%w: stopped after %s", ErrProcessingTimeout, s.cfg.ProcessingTimeout)
+		}
+	}()
+
+	source, release, err := s.prepareImage(ctx, fileBytes, filename, compressSizes, opts, timings)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	img, format, plans := source.img, source.format, source.plans
+	warnings := source.warnings
+
+	// Partition keys by date, before naming so suffix naming checks the right prefix
+	partition, partitionWarning := s.datePartition(fileBytes)
+	opts.partition = partition
+	if partitionWarning != "" {
+		warnings = append(warnings, partitionWarning)
+	}
+
+	// Optionally flag an image already stored under the same name
+	if s.cfg.NameCollision != "" {
+		existing, err := s.nameCollision(ctx, filename, format, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check for name collisions: %w", err)
+		}
+		switch {
+		case existing == "":
+		case s.cfg.NameCollision == NameCollisionError:
+			return nil, fmt.Errorf("%w: %s", ErrNameCollision, existing)
+		default:
+			warnings = append(warnings, "an image with the same name already exists: "+existing)
+		}
+	}
+
+	// Generate a unique file name for the original image; content naming
+	// keys it by the hash of the uploaded bytes
+	if opts.ContentSHA256 == "" {
+		opts.ContentSHA256 = contentSHA256(fileBytes)
+	}
+	name, err := s.newKeyName(ctx, filename, format, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		return nil, err
 	}
+	originalFileName := name.original()
 
-	// Generate a unique file name for the original image
-	timestamp := time.Now().UnixNano()
-	fileExt := strings.ToLower(filepath.Ext(filename))
-	fileNameWithoutExt := strings.TrimSuffix(filename, fileExt)
-	originalFileName := fmt.Sprintf("%s_%d%s", fileNameWithoutExt, timestamp, fileExt)
+	// Optionally store a re-encoded original instead of the uploaded bytes.
+	// A rotated original is always re-encoded: without its EXIF it would
+	// otherwise display sideways.
+	originalBytes := fileBytes
+	originalQuality, originalClamped := 0, false
+	reencodeOriginal := (s.cfg.ReencodeOriginal || source.rotated) && source.anim == nil
+	if !reencodeOriginal && s.cfg.StripEXIF && format == "jpeg" {
+		stripped, ok := stripJPEGMetadata(fileBytes)
+		if ok {
+			originalBytes = stripped
+		} else {
+			// Re-encoding is the only way left to drop the metadata
+			reencodeOriginal = true
+		}
+	}
+	if reencodeOriginal {
+		if format == "jpeg" || format == "webp" {
+			originalQuality, originalClamped = s.effectiveQuality(s.cfg.OriginalQuality)
+		}
+		doneEncode := timings.track("encode_original")
+		originalBytes, err = encodeImage(img, format, originalQuality, false, s.pngCompression(opts.PNGCompression))
+		doneEncode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-encode original image: %w", err)
+		}
+	}
 
 	// Upload original image to S3
-	originalURL, err := s.repo.UploadFile(fileBytes, originalFileName, getContentType(format))
+	doneUpload := timings.track("upload_original")
+	originalKey := s.objectKey(format, opts, originalFileName)
+	originalExisted, err := s.preexisting(ctx, originalKey)
+	if err != nil {
+		doneUpload()
+		return nil, fmt.Errorf("failed to upload original image: %w", err)
+	}
+	var originalURL string
+	if originalExisted {
+		// Content-named objects are never rewritten, so their URLs stay immutable
+		originalURL, err = s.repo.ObjectURL(ctx, originalKey)
+	} else {
+		originalURL, err = s.repo.UploadFile(ctx, originalBytes, originalKey, getContentType(format),
+			repository.PutOptions{StorageClass: opts.StorageClass, CacheControl: s.cfg.OriginalCacheControl})
+	}
+	doneUpload()
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload original image: %w", err)
 	}
+	if !originalExisted {
+		stored = append(stored, originalKey)
+	}
 
-	// Create response object
+	// Create response object; the original's dimensions are those of the
+	// stored object, which differ from the source's once it is transformed
 	originalBounds := img.Bounds()
-	response := &models.UploadResponse{
+	response = &models.UploadResponse{
+		SourceWidth:  source.bounds.Dx(),
+		SourceHeight: source.bounds.Dy(),
 		OriginalImage: models.ImageResult{
-			Width:  originalBounds.Dx(),
-			Height: originalBounds.Dy(),
-			URL:    originalURL,
+			Width:            originalBounds.Dx(),
+			Height:           originalBounds.Dy(),
+			URL:              originalURL,
+			Key:              originalKey,
+			Backend:          s.repo.Backend(),
+			Format:           format,
+			Quality:          originalQuality,
+			QualityClamped:   originalClamped,
+			DownloadFilename: s.downloadFilename(name.source, originalBounds.Dx(), originalBounds.Dy(), name.ext),
 		},
-		CompressedImages: []models.ImageResult{},
-		Message:          "Image uploaded and processed successfully",
+		OriginalReencoded: reencodeOriginal,
+		Profile:           opts.Profile,
+		Collection:        opts.Collection,
+		ContentSHA256:     opts.ContentSHA256,
+		Histogram:         source.histogram,
+		CompressedImages:  []models.ImageResult{},
+		Message:           "Image uploaded and processed successfully",
 	}
 
-	// Process and upload each compressed size
-	for _, spec := range compressSizes {
-		// Resize the image
-		resizedImg := resize.Resize(uint(spec.Width), uint(spec.Height), img, resize.Lanczos3)
+	// In lazy mode the specs are only validated; variants are made on request
+	if s.cfg.LazyVariants {
+		response.Message = "Image uploaded; variants are generated on first request"
+		response.Warnings = s.warnings(warnings, plans, originalClamped)
+		if opts.Debug {
+			response.Diagnostics = s.diagnostics(source, opts, timings, response)
+		}
+		s.signReceipt(response)
+		return response, nil
+	}
 
-		// Encode the resized image
-		var buf bytes.Buffer
-		var encodeErr error
+	// Process and upload the compressed sizes; results keep the order of the specs
+	results := make([]models.ImageResult, len(plans))
+	created := make([]bool, len(plans))
+	errs := make([]error, len(plans))
+	var done atomic.Int32
+	if opts.Progress != nil {
+		opts.Progress(0, len(plans))
+	}
+	s.runVariants(len(plans), func(i int) {
+		results[i], created[i], errs[i] = s.processVariant(ctx, plans[i], source, name, opts, timings)
+		if opts.Progress != nil {
+			opts.Progress(int(done.Add(1)), len(plans))
+		}
+	})
 
-		if format == "jpeg" {
-			encodeErr = jpeg.Encode(&buf, resizedImg, &jpeg.Options{Quality: 85})
-		} else {
-			encodeErr = png.Encode(&buf, resizedImg)
+	var panicErr error
+	for i, plan := range plans {
+		switch {
+		case errs[i] == nil:
+			response.CompressedImages = append(response.CompressedImages, results[i])
+			if created[i] {
+				stored = append(stored, results[i].Key)
+			}
+		case errors.Is(errs[i], ErrProcessingPanic):
+			if panicErr == nil {
+				panicErr = errs[i]
+			}
+		default:
+			response.FailedSizes = append(response.FailedSizes, failedSize(plan, errs[i]))
+		}
+	}
+	// A panicking size fails the whole upload, so nothing of it is kept
+	if panicErr != nil {
+		s.removeStored(context.WithoutCancel(ctx), stored)
+		return nil, panicErr
+	}
+	// Without a live request there is no one to report partial results to
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("failed to upload compressed images: %w", ctx.Err())
+	}
+
+	if len(response.FailedSizes) > 0 {
+		response.Message = "Image uploaded; some sizes failed to process"
+	}
+	sortResults(response.CompressedImages, source.order)
+	response.Warnings = s.warnings(warnings, plans, originalClamped)
+	if opts.Debug {
+		response.Diagnostics = s.diagnostics(source, opts, timings, response)
+	}
+
+	s.signReceipt(response)
+	return response, nil
+}
+
+// preparedImage is an upload decoded, adjusted and planned, ready for its
+// variants to be rendered. It is shared read-only by the variant workers.
+type preparedImage struct {
+	img       image.Image
+	anim      *gif.GIF // All frames of an animated GIF; nil for still images
+	format    string
+	bounds    image.Rectangle // Dimensions as decoded and turned upright, before anything transforms the image
+	rotated   bool            // An EXIF orientation was applied
+	histogram *models.Histogram
+	plans     []variantPlan
+	order     string
+	warnings  []string
+}
+
+// prepareImage takes a processing slot, then decodes, validates, trims and
+// adjusts an upload and plans its variants, so that nothing is stored when
+// the request is invalid. The caller must call release once done.
+func (s *ImageService) prepareImage(
+	ctx context.Context,
+	fileBytes []byte,
+	filename string,
+	compressSizes []models.CompressSpec,
+	opts UploadOptions,
+	timings *stageTimings,
+) (source *preparedImage, release func(), err error) {
+	// Reject undersized uploads from the header alone, before queueing or decoding
+	if err := s.checkMinSource(fileBytes, opts); err != nil {
+		return nil, nil, err
+	}
+
+	// Wait for a processing slot so bursts queue instead of exhausting memory
+	doneQueue := timings.track("queue")
+	slot, err := s.queue.acquire(ctx)
+	doneQueue()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			slot()
+		}
+	}()
+
+	// Decode the image, upright
+	doneDecode := timings.track("decode")
+	img, format, rotated, err := s.decodeUpright(fileBytes)
+	doneDecode()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	source = &preparedImage{format: format, bounds: img.Bounds(), rotated: rotated}
+	source.anim, err = decodeAnimation(fileBytes, format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	if err := validateAdjustments(opts.Brightness, opts.Contrast); err != nil {
+		return nil, nil, err
+	}
+	if opts.Trim {
+		if err := validateTrim(opts.TrimTolerance); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Counted before adjustments so it describes the upload itself
+	if opts.Histogram {
+		doneHistogram := timings.track("histogram")
+		source.histogram = histogram(img)
+		doneHistogram()
+	}
+	var pipelineWarnings []string
+	source.img, pipelineWarnings = s.runPipeline(img, opts, timings)
+	source.warnings = append(source.warnings, pipelineWarnings...)
+
+	// Resolve every spec and reject the request before anything is stored if one is invalid
+	var skipped []string
+	source.plans, skipped, err = s.planVariants(compressSizes, opts, format, source.img)
+	if err != nil {
+		return nil, nil, err
+	}
+	source.warnings = append(source.warnings, skipped...)
+
+	for _, class := range []string{opts.StorageClass, opts.VariantStorageClass} {
+		if class != "" && !repository.ValidStorageClass(class) {
+			return nil, nil, fmt.Errorf("%w: unsupported storage class %q", ErrInvalidSpec, class)
+		}
+	}
+
+	source.order = cmp.Or(opts.Sort, s.cfg.VariantSort, SortRequest)
+	if source.order != SortRequest && source.order != SortAreaAsc && source.order != SortAreaDesc {
+		return nil, nil, fmt.Errorf("%w: unsupported sort %q", ErrInvalidSpec, source.order)
+	}
+
+	if source.anim != nil {
+		source.warnings = append(source.warnings, animationWarnings(source.plans, opts)...)
+	}
+	if ext := filepath.Ext(filename); ext != "" {
+		if labelled, _ := normalizeFormat(strings.TrimPrefix(ext, ".")); labelled != format {
+			source.warnings = append(source.warnings, fmt.Sprintf("file extension %s does not match its %s content; stored as %s", ext, format, format))
+		}
+	}
+
+	return source, slot, nil
+}
+
+// runVariants calls work for each of count variants on a bounded pool of
+// workers and returns once all are done
+func (s *ImageService) runVariants(count int, work func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(s.cfg.VariantConcurrency, 1), count) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				work(i)
+			}
+		}()
+	}
+	for i := range count {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// processVariant renders and uploads one compressed size of an upload,
+// reporting whether it created the object rather than writing over one an
+// earlier upload stored
+func (s *ImageService) processVariant(
+	ctx context.Context,
+	plan variantPlan,
+	source *preparedImage,
+	name keyName,
+	opts UploadOptions,
+	timings *stageTimings,
+) (result models.ImageResult, created bool, err error) {
+	// Sizes not started before the request ended are not worth starting
+	if err := ctx.Err(); err != nil {
+		return models.ImageResult{}, false, err
+	}
+
+	spec := plan.spec
+	variantExt := variantExtension(plan, source.format, name.ext)
+	compressedKey := s.objectKey(plan.format, opts, name.variant(spec.Width, spec.Height, plan.tag, variantExt))
+	result = s.variantResult(plan, name.source, variantExt)
+	result.Key = compressedKey
+	result.Backend = s.repo.Backend()
+
+	// A content-named variant already stored was made from the same bytes
+	// with the same settings; it is reused so its URL never changes
+	existed, err := s.preexisting(ctx, compressedKey)
+	if err != nil {
+		return models.ImageResult{}, false, err
+	}
+	if existed {
+		if result.URL, err = s.repo.ObjectURL(ctx, compressedKey); err != nil {
+			return models.ImageResult{}, false, err
+		}
+		return result, false, nil
+	}
+
+	encoded, _, err := s.renderVariant(ctx, plan, source, name.ext, timings)
+	if err != nil {
+		return models.ImageResult{}, false, err
+	}
+
+	// Upload the compressed image to S3, retrying transient failures
+	doneUpload := timings.track("upload_variants")
+	compressedURL, uploadErr := s.uploadWithRetry(ctx, encoded, compressedKey, getContentType(plan.format),
+		repository.PutOptions{StorageClass: opts.VariantStorageClass, CacheControl: s.cfg.VariantCacheControl})
+	doneUpload()
+	if uploadErr != nil {
+		s.logger.ErrorContext(ctx, "Failed to upload compressed image", "key", compressedKey, "size", len(encoded), "error", uploadErr)
+		return models.ImageResult{}, false, uploadErr
+	}
+
+	result.URL = compressedURL
+	return result, true, nil
+}
+
+// renderVariant resizes and encodes one compressed size, returning the
+// encoded bytes and their file extension: the upload's own extension when
+// the format is unchanged. It runs on the variant workers, so it only reads
+// the shared source, and reports a panic as ErrProcessingPanic.
+func (s *ImageService) renderVariant(ctx context.Context, plan variantPlan, source *preparedImage, ext string, timings *stageTimings) (encoded []byte, variantExt string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.ErrorContext(ctx, "Recovered from panic while processing a variant",
+				"width", plan.spec.Width, "height", plan.spec.Height, "format", plan.format, "panic", r, "stack", string(debug.Stack()))
+			encoded, variantExt, err = nil, "", fmt.Errorf("%w: %v", ErrProcessingPanic, r)
+		}
+	}()
+
+	// Resize the image, every frame of it for animated GIF output
+	doneResize := timings.track("resize")
+	var resizedImg image.Image
+	var resizedAnim *gif.GIF
+	if source.anim != nil && plan.format == "gif" {
+		resizedAnim = resizeAnimation(source.anim, plan)
+	} else {
+		resizedImg = resizeForPlan(source.img, plan)
+	}
+	doneResize()
+
+	// Encode the resized image
+	doneEncode := timings.track("encode")
+	if resizedAnim != nil {
+		encoded, err = encodeAnimation(resizedAnim)
+	} else {
+		encoded, err = encodeImage(resizedImg, plan.format, plan.quality, plan.lossless, plan.compression)
+	}
+	doneEncode()
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to encode compressed image", "width", plan.spec.Width, "height", plan.spec.Height, "format", plan.format, "error", err)
+		return nil, "", err
+	}
+
+	return encoded, variantExtension(plan, source.format, ext), nil
+}
+
+// Helper function to get a variant's file extension: the upload's own
+// extension when the format is unchanged
+func variantExtension(plan variantPlan, sourceFormat string, ext string) string {
+	if plan.format != sourceFormat {
+		return formatExtension(plan.format)
+	}
+	return ext
+}
+
+// Helper function to describe a rendered variant, apart from where it is stored
+func (s *ImageService) variantResult(plan variantPlan, sourceName string, ext string) models.ImageResult {
+	spec := plan.spec
+	return models.ImageResult{
+		Width:            spec.Width,
+		Height:           spec.Height,
+		Format:           plan.format,
+		Quality:          plan.quality,
+		QualityClamped:   plan.clamped,
+		Lossless:         plan.lossless,
+		ScaleX:           plan.scaleX,
+		ScaleY:           plan.scaleY,
+		AspectPolicy:     plan.aspectPolicy,
+		DownloadFilename: s.downloadFilename(sourceName, spec.Width, spec.Height, ext),
+	}
+}
+
+// Helper function to check whether a key is already stored by an earlier
+// upload, which content naming gives the same keys for the same bytes;
+// such objects are neither rewritten nor removed by an aborted upload. Other namings make fresh
+// keys, and a failed check counts as missing as it does for suffix naming.
+func (s *ImageService) preexisting(ctx context.Context, key string) (bool, error) {
+	if s.cfg.KeyNaming != KeyNamingContent {
+		return false, nil
+	}
+	if _, err := s.repo.GetFile(ctx, key); err != nil {
+		if isContextError(err) {
+			return false, err
 		}
+		return false, nil
+	}
+	return true, nil
+}
 
-		if encodeErr != nil {
-			log.Printf("Failed to encode compressed image: %v", encodeErr)
+// Helper function to delete the objects of an upload that is not completed,
+// logging failures since the upload's error is what gets reported
+func (s *ImageService) removeStored(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.repo.DeleteFile(ctx, key); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to remove an object of an aborted upload", "key", key, "error", err)
+		}
+	}
+}
+
+// OpenImage opens a stored image for streaming, optionally only the byte
+// range of an HTTP Range header, within the tenant's namespace if one is
+// given. The caller closes the body.
+func (s *ImageService) OpenImage(ctx context.Context, tenant string, filename string, byteRange string) (*repository.ObjectStream, error) {
+	if !s.inScope(filename, tenant) {
+		return nil, ErrImageNotFound
+	}
+	stream, err := s.repo.StreamFile(ctx, filename, byteRange)
+	if err != nil {
+		if errors.Is(err, repository.ErrRangeNotSatisfiable) {
+			return nil, err
+		}
+		return nil, lookupError(err)
+	}
+	return stream, nil
+}
+
+// GetImageInfo gets information about an image by filename, within the
+// tenant's namespace if one is given
+func (s *ImageService) GetImageInfo(ctx context.Context, tenant string, filename string) (*models.ImageResult, error) {
+	if !s.inScope(filename, tenant) {
+		return nil, ErrImageNotFound
+	}
+	info, err := s.repo.GetFile(ctx, filename)
+	if err != nil {
+		return nil, lookupError(err)
+	}
+
+	// Same URL UploadFile returns for the key, custom endpoint or AWS
+	imageURL, err := s.repo.ObjectURL(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build image URL: %w", err)
+	}
+
+	result := &models.ImageResult{
+		URL:              imageURL,
+		Key:              filename,
+		Backend:          s.repo.Backend(),
+		UploadedAt:       uploadTimeFromKey(filename),
+		DownloadFilename: s.DownloadFilename(filename),
+	}
+	if !info.LastModified.IsZero() {
+		lastModified := info.LastModified.UTC()
+		result.LastModified = &lastModified
+	}
+
+	// Read the dimensions from the stored image itself, whatever its key
+	header, format, err := s.storedImageConfig(ctx, filename, info.Size)
+	if err != nil {
+		if isContextError(err) {
+			return nil, err
+		}
+		// Not a decodable image: width and height stay zero
+		s.logger.WarnContext(ctx, "Failed to read image dimensions", "key", filename, "error", err)
+		return result, nil
+	}
+	result.Width, result.Height, result.Format = header.Width, header.Height, format
+	base, _, _, ext := s.downloadNameParts(filename)
+	result.DownloadFilename = s.downloadFilename(base, header.Width, header.Height, ext)
+	return result, nil
+}
+
+// imageHeaderBytes is how much of a stored image is fetched to decode its
+// header; image files put their dimensions, and JPEGs their EXIF, up front
+const imageHeaderBytes = 256 << 10
+
+// Helper function to decode the dimensions of a stored image without its
+// pixels. Only the start of the object is fetched, unless its header turns
+// out to be longer. A JPEG whose EXIF orientation swaps the axes reports
+// the dimensions it displays at.
+func (s *ImageService) storedImageConfig(ctx context.Context, key string, size int64) (image.Config, string, error) {
+	byteRange := ""
+	if size > imageHeaderBytes {
+		byteRange = fmt.Sprintf("bytes=0-%d", imageHeaderBytes-1)
+	}
+	stream, err := s.repo.StreamFile(ctx, key, byteRange)
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	head, err := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	if err != nil {
+		return image.Config{}, "", err
+	}
+
+	header, format, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil && byteRange != "" {
+		if head, err = s.repo.DownloadFile(ctx, key); err != nil {
+			return image.Config{}, "", err
+		}
+		header, format, err = image.DecodeConfig(bytes.NewReader(head))
+	}
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	if format == "jpeg" && orientationTransposes(exifOrientation(head)) {
+		header.Width, header.Height = header.Height, header.Width
+	}
+	return header, format, nil
+}
+
+// Variant returns the URL of a transformed copy of an original, generating
+// and caching it the first time it is requested. Only available in lazy mode.
+func (s *ImageService) Variant(ctx context.Context, tenant string, filename string, spec models.CompressSpec) (url string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.ErrorContext(ctx, "Recovered from panic while generating a variant", "filename", filename, "panic", r, "stack", string(debug.Stack()))
+			url, err = "", fmt.Errorf("%w: %v", ErrProcessingPanic, r)
+		}
+	}()
+
+	if !s.cfg.LazyVariants {
+		return "", fmt.Errorf("%w: on-demand variants are disabled", ErrInvalidSpec)
+	}
+	if spec.Width < 0 || spec.Height < 0 || (spec.Width == 0 && spec.Height == 0) {
+		return "", fmt.Errorf("%w: width and height must not be negative and one must be set", ErrInvalidSpec)
+	}
+	// Every distinct size is rendered in memory and cached for good
+	if limit := s.cfg.LazyVariantMaxDimension; spec.Width > limit || spec.Height > limit {
+		return "", fmt.Errorf("%w: width and height must not exceed %d", ErrInvalidSpec, limit)
+	}
+	// The cache key is derived before the image is read, so the format must be known
+	if strings.EqualFold(spec.Format, FormatAuto) {
+		return "", fmt.Errorf("%w: the auto format is only supported on upload", ErrInvalidSpec)
+	}
+
+	if !s.inScope(filename, tenant) {
+		return "", ErrImageNotFound
+	}
+	if !s.isOriginalKey(filename) {
+		return "", fmt.Errorf("%w: variants are only made of originals, not of other variants", ErrInvalidSpec)
+	}
+
+	// Serve a previously generated copy of the same transform
+	key := cachedVariantKey(filename, spec)
+	if _, err := s.repo.GetFile(ctx, key); err == nil {
+		return s.repo.ObjectURL(ctx, key)
+	}
+
+	release, err := s.queue.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	fileBytes, err := s.repo.DownloadFile(ctx, filename)
+	if err != nil {
+		return "", lookupError(err)
+	}
+
+	img, format, _, err := s.decodeUpright(fileBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	plans, skipped, err := s.planVariants([]models.CompressSpec{spec}, UploadOptions{}, format, img)
+	if err != nil {
+		return "", err
+	}
+	if len(plans) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrInvalidSpec, skipped[0])
+	}
+	plan := plans[0]
+
+	anim, err := decodeAnimation(fileBytes, format)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	var encoded []byte
+	if anim != nil && plan.format == "gif" {
+		encoded, err = encodeAnimation(resizeAnimation(anim, plan))
+	} else {
+		encoded, err = encodeImage(resizeForPlan(img, plan), plan.format, plan.quality, plan.lossless, plan.compression)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to encode variant: %w", err)
+	}
+
+	return s.repo.UploadFile(ctx, encoded, key, getContentType(plan.format), repository.PutOptions{CacheControl: s.cfg.VariantCacheControl})
+}
+
+// DeleteImage removes an image, and with withVariants also the compressed
+// and on-demand variants sharing its name and token. The deleted keys are
+// purged from the CDN. Another tenant's image is reported as not found.
+func (s *ImageService) DeleteImage(ctx context.Context, tenant string, filename string, withVariants bool) error {
+	if !s.inScope(filename, tenant) {
+		return ErrImageNotFound
+	}
+	if _, err := s.repo.GetFile(ctx, filename); err != nil {
+		return lookupError(err)
+	}
+
+	keys := []string{filename}
+	if withVariants {
+		variants, err := s.variantKeys(ctx, filename)
+		if err != nil {
+			return fmt.Errorf("failed to list variants: %w", err)
+		}
+		keys = append(keys, variants...)
+	}
+
+	for i, key := range keys {
+		if err := s.repo.DeleteFile(ctx, key); err != nil {
+			s.invalidateCDN(keys[:i]...)
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+	}
+	s.invalidateCDN(keys...)
+
+	return nil
+}
+
+// MoveImage moves an image and its upload-time variants to another key,
+// within the tenant's namespace if one is given, and returns the image's
+// new location. Variants are renamed to match the destination; on-demand
+// variants are keyed by the original's key, so they are dropped and made
+// again when next requested. An existing destination is only replaced when
+// overwrite is set; nil uses the configured default. Its variants go with it.
+func (s *ImageService) MoveImage(ctx context.Context, tenant string, filename string, destination string, overwrite *bool) (*models.ImageResult, error) {
+	replace := s.cfg.MoveOverwrite
+	if overwrite != nil {
+		replace = *overwrite
+	}
+	if destination == filename {
+		return nil, fmt.Errorf("%w: %s is already the image's key", ErrInvalidSpec, destination)
+	}
+	if !s.inScope(filename, tenant) {
+		return nil, ErrImageNotFound
+	}
+	if !s.inScope(destination, tenant) {
+		scope := joinKey(s.cfg.Environment)
+		if tenant != "" {
+			scope = joinKey(s.cfg.Environment, s.cfg.KeyPrefix, tenantSegment(tenant))
+		}
+		return nil, fmt.Errorf("%w: destination must stay under %s/", ErrInvalidSpec, scope)
+	}
+	if _, err := s.repo.GetFile(ctx, filename); err != nil {
+		return nil, lookupError(err)
+	}
+
+	variants, err := s.variantKeys(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list variants: %w", err)
+	}
+	cachedPrefix := strings.TrimSuffix(filename, filepath.Ext(filename)) + "/"
+	moves := [][2]string{{filename, destination}}
+	var dropped []string
+	for _, variant := range variants {
+		if strings.HasPrefix(variant, cachedPrefix) {
+			dropped = append(dropped, variant)
 			continue
 		}
+		moves = append(moves, [2]string{variant, s.movedVariantKey(filename, variant, destination)})
+	}
 
-		// Generate a unique filename for the compressed image
-		compressedFileName := fmt.Sprintf("%s_%dx%d_%d%s",
-			fileNameWithoutExt, spec.Width, spec.Height, timestamp, fileExt)
+	// Check every destination first, so a conflict leaves everything in place
+	var replaced []string
+	for _, move := range moves {
+		_, err := s.repo.GetFile(ctx, move[1])
+		switch {
+		case err == nil && !replace:
+			return nil, fmt.Errorf("%w: %s", ErrDestinationExists, move[1])
+		case err == nil:
+			replaced = append(replaced, move[1])
+		case isContextError(err):
+			return nil, err
+		}
+	}
+	// A replaced image's own variants would otherwise outlive it: the
+	// on-demand ones are cached by key and would be served for the new image
+	if len(replaced) > 0 && replaced[0] == destination {
+		stale, err := s.variantKeys(ctx, destination)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the destination's variants: %w", err)
+		}
+		for _, key := range stale {
+			if !slices.ContainsFunc(moves, func(move [2]string) bool { return move[1] == key }) {
+				dropped = append(dropped, key)
+			}
+		}
+	}
 
-		// Upload the compressed image to S3
-		compressedURL, uploadErr := s.repo.UploadFile(buf.Bytes(), compressedFileName, getContentType(format))
-		if uploadErr != nil {
-			log.Printf("Failed to upload compressed image: %v", uploadErr)
+	invalidate := replaced
+	for _, move := range moves {
+		if err := s.repo.MoveFile(ctx, move[0], move[1]); err != nil {
+			s.invalidateCDN(invalidate...)
+			return nil, fmt.Errorf("failed to move %s: %w", move[0], err)
+		}
+		invalidate = append(invalidate, move[0])
+	}
+	for _, key := range dropped {
+		if err := s.repo.DeleteFile(ctx, key); err != nil {
+			s.logger.WarnContext(ctx, "Failed to remove a variant dropped by a move", "key", key, "error", err)
 			continue
 		}
+		invalidate = append(invalidate, key)
+	}
+	s.invalidateCDN(invalidate...)
 
-		// Add to response
-		response.CompressedImages = append(response.CompressedImages, models.ImageResult{
-			Width:  spec.Width,
-			Height: spec.Height,
-			URL:    compressedURL,
+	return s.GetImageInfo(ctx, tenant, destination)
+}
+
+// SignedURL returns a presigned GET URL for an existing image in the
+// tenant's namespace, if one is given; a zero expiry uses the default
+func (s *ImageService) SignedURL(ctx context.Context, tenant string, filename string, expiry time.Duration, overrides repository.ResponseOverrides) (*models.SignedURLResponse, error) {
+	if !s.inScope(filename, tenant) {
+		return nil, ErrImageNotFound
+	}
+	if _, err := s.repo.GetFile(ctx, filename); err != nil {
+		return nil, lookupError(err)
+	}
+
+	signedURL, expiresAt, err := s.repo.PresignGetURL(ctx, filename, expiry, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SignedURLResponse{
+		URL:       signedURL,
+		ExpiresAt: expiresAt.UTC(),
+	}, nil
+}
+
+// ListImages lists the images in the S3 bucket, restricted to the
+// environment and to a tenant's namespace if one is given. Key-ordered listings with a limit or token are
+// read one page at a time and return the token of the next page; sorted
+// listings read everything and return no token.
+func (s *ImageService) ListImages(ctx context.Context, tenant string, opts ListOptions) ([]models.ListedImage, string, error) {
+	if err := opts.validate(); err != nil {
+		return nil, "", err
+	}
+
+	prefix := joinKey(s.cfg.Environment, s.cfg.KeyPrefix, tenantSegment(tenant), opts.Collection)
+	if opts.AllEnvironments {
+		if tenant != "" || opts.Collection != "" {
+			return nil, "", fmt.Errorf("%w: listing all environments can't be combined with a tenant namespace or collection", ErrInvalidQuery)
+		}
+		// The prefix is then relative to the bucket root
+		prefix = ""
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	prefix += opts.Prefix
+
+	var files []repository.FileInfo
+	var next string
+	var err error
+	if opts.paged() {
+		files, next, err = s.repo.ListPage(ctx, prefix, opts.Limit, opts.Token)
+	} else {
+		files, err = s.repo.ListFiles(ctx, prefix)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	images := make([]models.ListedImage, 0, len(files))
+	for _, file := range files {
+		images = append(images, models.ListedImage{
+			Key:          file.Key,
+			Size:         file.Size,
+			LastModified: file.LastModified.UTC(),
 		})
 	}
+	sortListing(images, opts)
 
-	return response, nil
+	if opts.Limit > 0 && len(images) > opts.Limit {
+		images = images[:opts.Limit]
+	}
+	return images, next, nil
 }
 
-// GetImageInfo gets information about an image by filename
-func (s *ImageService) GetImageInfo(filename string) (*models.ImageResult, error) {
-	exists, err := s.repo.GetFile(filename)
-	if err != nil || !exists {
-		return nil, fmt.Errorf("image not found")
-	}
-
-	// Generate the URL for the image
-	var imageURL string
-	// Note: This requires access to the S3 config, which could be passed to the service
-	// For now, we're using a simplified approach
-	imageURL = fmt.Sprintf("https://s3-url/%s", filename)
-
-	// Extract dimensions from filename if available (format: name_WxH_timestamp.ext)
-	parts := strings.Split(filename, "_")
-	if len(parts) >= 2 {
-		dimParts := strings.Split(parts[len(parts)-2], "x")
-		if len(dimParts) == 2 {
-			width := 0
-			height := 0
-			fmt.Sscanf(dimParts[0], "%d", &width)
-			fmt.Sscanf(dimParts[1], "%d", &height)
-			if width > 0 && height > 0 {
-				return &models.ImageResult{
-					Width:  width,
-					Height: height,
-					URL:    imageURL,
-				}, nil
-			}
+// invalidateCDN purges deleted or overwritten keys from the CDN without
+// blocking the caller; failures are logged since S3 is already consistent
+func (s *ImageService) invalidateCDN(keys ...string) {
+	if s.cdn == nil || len(keys) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cdnInvalidationTimeout)
+		defer cancel()
+
+		if err := s.cdn.Invalidate(ctx, keys); err != nil {
+			s.logger.Warn("Failed to invalidate CDN cache", "keys", keys, "error", err)
 		}
+	}()
+}
+
+// checkMinSource enforces the minimum source dimensions of the request's profile,
+// or the global minimum when the profile doesn't set one
+func (s *ImageService) checkMinSource(fileBytes []byte, opts UploadOptions) error {
+	profile, err := s.profile(opts.Profile)
+	if err != nil {
+		return err
 	}
 
-	// If dimensions can't be extracted, return just the URL
-	return &models.ImageResult{
-		Width:  0,
-		Height: 0,
-		URL:    imageURL,
-	}, nil
+	minimum := s.cfg.MinSourceDimensions
+	if profile.MinSource != (config.Dimensions{}) {
+		minimum = profile.MinSource
+	}
+	if minimum == (config.Dimensions{}) {
+		return nil
+	}
+
+	header, format, err := image.DecodeConfig(bytes.NewReader(fileBytes))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	// Compare the upright dimensions, as decodeUpright will produce them
+	if s.cfg.StripEXIF && format == "jpeg" && orientationTransposes(exifOrientation(fileBytes)) {
+		header.Width, header.Height = header.Height, header.Width
+	}
+	if header.Width < minimum.Width || header.Height < minimum.Height {
+		return fmt.Errorf("%w: %dx%d is below the minimum of %dx%d", ErrImageTooSmall, header.Width, header.Height, minimum.Width, minimum.Height)
+	}
+
+	return nil
 }
 
-// ListImages lists all images in the S3 bucket
-func (s *ImageService) ListImages() ([]string, error) {
-	return s.repo.ListFiles()
+// uploadWithRetry uploads a variant, retrying with exponential backoff up
+// to the configured number of attempts while ctx is live
+func (s *ImageService) uploadWithRetry(ctx context.Context, fileBytes []byte, key string, contentType string, putOpts repository.PutOptions) (string, error) {
+	backoff := s.cfg.UploadRetryBackoff
+	attempts := max(s.cfg.UploadAttempts, 1)
+
+	for attempt := 1; ; attempt++ {
+		url, err := s.repo.UploadFile(ctx, fileBytes, key, contentType, putOpts)
+		if err == nil || attempt == attempts || ctx.Err() != nil {
+			return url, err
+		}
+
+		s.logger.WarnContext(ctx, "Upload failed, retrying", "key", key, "attempt", attempt, "attempts", attempts, "backoff", backoff.String(), "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// Helper function to record a variant that couldn't be produced
+func failedSize(plan variantPlan, err error) models.FailedSize {
+	return models.FailedSize{
+		Width:  plan.spec.Width,
+		Height: plan.spec.Height,
+		Format: plan.format,
+		Error:  err.Error(),
+	}
+}
+
+// warnIfSlow logs the stage breakdown of an upload that exceeded the slow threshold
+func (s *ImageService) warnIfSlow(ctx context.Context, timings *stageTimings, filename string, size int, specs []models.CompressSpec) {
+	total := timings.total()
+	if s.cfg.SlowThreshold <= 0 || total < s.cfg.SlowThreshold {
+		return
+	}
+
+	sizes := make([]string, len(specs))
+	for i, spec := range specs {
+		sizes[i] = fmt.Sprintf("%dx%d", spec.Width, spec.Height)
+	}
+
+	s.logger.WarnContext(ctx, "Slow upload",
+		"filename", filename,
+		"size", size,
+		"sizes", strings.Join(sizes, ","),
+		"total_ms", float64(total.Microseconds())/1000,
+		"threshold", s.cfg.SlowThreshold.String(),
+		"timings_ms", timings.milliseconds(),
+	)
+}
+
+// objectKey assembles a key as key prefix / tenant / format prefix / date / folder / name.
+// The tenant comes before the format prefix so a tenant's objects share one
+// listable prefix.
+func (s *ImageService) objectKey(format string, opts UploadOptions, name string) string {
+	return joinKey(s.cfg.Environment, s.cfg.KeyPrefix, tenantSegment(opts.Tenant), opts.Collection, s.cfg.FormatPrefixes[format], opts.partition, opts.Folder, name)
+}
+
+// Helper function to check a key belongs to the configured environment;
+// every key does when none is set
+func (s *ImageService) inEnvironment(key string) bool {
+	environment := joinKey(s.cfg.Environment)
+	return environment == "" || strings.HasPrefix(key, environment+"/")
+}
+
+// Helper function to check a key belongs to the environment and, for an
+// authenticated caller, to the tenant's own namespace. Keys outside it are
+// reported as missing so callers can't probe other tenants' objects.
+func (s *ImageService) inScope(key string, tenant string) bool {
+	if !s.inEnvironment(key) {
+		return false
+	}
+	if tenant == "" {
+		return true
+	}
+	return strings.HasPrefix(key, joinKey(s.cfg.Environment, s.cfg.KeyPrefix, tenantSegment(tenant))+"/")
+}
+
+// datePartition formats the configured date partition from the EXIF capture
+// time when enabled and present, otherwise from the upload time; the second
+// result is a warning when the EXIF time was wanted but unreadable
+func (s *ImageService) datePartition(fileBytes []byte) (string, string) {
+	if s.cfg.DatePartition == "" {
+		return "", ""
+	}
+
+	if s.cfg.DatePartitionFromEXIF {
+		if taken, ok := captureTime(fileBytes); ok {
+			return taken.Format(s.cfg.DatePartition), ""
+		}
+		return time.Now().UTC().Format(s.cfg.DatePartition), "EXIF capture time could not be read; keys are partitioned by upload time"
+	}
+	return time.Now().UTC().Format(s.cfg.DatePartition), ""
 }
 
-// Helper function to decode an image
+// effectiveQuality clamps a requested quality to the valid range and the
+// configured floor, reporting whether the floor had to be applied
+func (s *ImageService) effectiveQuality(requested int) (int, bool) {
+	quality := min(max(requested, 1), 100)
+	if quality < s.cfg.MinQuality {
+		return min(s.cfg.MinQuality, 100), true
+	}
+	return quality, false
+}
+
+// Helper function to compute the hex SHA-256 of uploaded bytes
+func contentSHA256(fileBytes []byte) string {
+	sum := sha256.Sum256(fileBytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// Helper function to decode an image; WebP is registered with the image
+// package by the webp import, alongside JPEG, PNG and GIF. For a GIF this
+// is the first frame; decodeAnimation reads the rest.
 func decodeImage(fileBytes []byte) (image.Image, string, error) {
 	img, format, err := image.Decode(bytes.NewReader(fileBytes))
 	return img, format, err
 }
 
+// decodeUpright decodes an image and, with StripEXIF, applies the EXIF
+// orientation of a JPEG, reporting whether it had to be turned
+func (s *ImageService) decodeUpright(fileBytes []byte) (image.Image, string, bool, error) {
+	img, format, err := decodeImage(fileBytes)
+	if err != nil || !s.cfg.StripEXIF || format != "jpeg" {
+		return img, format, false, err
+	}
+	orientation := exifOrientation(fileBytes)
+	if orientation == 1 {
+		return img, format, false, nil
+	}
+	return orient(img, orientation), format, true, nil
+}
+
+// Helper function to recover the upload time from a key of the form name[_WxH]_timestamp.ext
+func uploadTimeFromKey(key string) *time.Time {
+	base := strings.TrimSuffix(key, filepath.Ext(key))
+	idx := strings.LastIndex(base, "_")
+	if idx < 0 {
+		return nil
+	}
+
+	nanos, err := strconv.ParseInt(base[idx+1:], 10, 64)
+	// Anything before 2001 is not a timestamp we generated
+	if err != nil || nanos < 1e18 {
+		return nil
+	}
+
+	uploadedAt := time.Unix(0, nanos).UTC()
+	return &uploadedAt
+}
+
+// Helper function to join key segments. S3 treats "a//b" and "a/b" as
+// distinct keys, so empty segments, repeated slashes and leading or
+// trailing slashes are all dropped.
+func joinKey(segments ...string) string {
+	var parts []string
+	for _, segment := range segments {
+		for _, part := range strings.Split(segment, "/") {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Helper function to build the key segment for a tenant, e.g. "auth0|42"
+// becomes "auth0_7c42": every byte other than a letter, digit or '-' is
+// escaped as '_' and its hex value. The escape character is escaped too, so
+// distinct tenants never share a namespace, and no segment is "." or "..".
+func tenantSegment(tenant string) string {
+	var b strings.Builder
+	for i := 0; i < len(tenant); i++ {
+		switch c := tenant[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// Helper function to encode an image; quality only applies to lossy formats
+// and lossless only to WebP
+func encodeImage(img image.Image, format string, quality int, lossless bool, compression png.CompressionLevel) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "webp":
+		err = webp.Encode(&buf, img, &webp.Options{Lossless: lossless, Quality: float32(quality)})
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		encoder := png.Encoder{CompressionLevel: compression}
+		err = encoder.Encode(&buf, img)
+	}
+
+	return buf.Bytes(), err
+}
+
+// PNG compression levels, from fastest and largest to slowest and smallest
+// apart from none, which skips compression altogether
+const (
+	PNGCompressionNone      = "none"
+	PNGCompressionBestSpeed = "best_speed"
+	PNGCompressionDefault   = "default"
+	PNGCompressionBest      = "best_compression"
+)
+
+// ValidPNGCompression reports whether name is a PNG compression level; the
+// empty name, for the server's, is valid too
+func ValidPNGCompression(name string) bool {
+	_, ok := pngCompressionLevel(name)
+	return ok
+}
+
+// Helper function to map a PNG compression name to its level; the empty
+// name is the encoder's default
+func pngCompressionLevel(name string) (png.CompressionLevel, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", PNGCompressionDefault:
+		return png.DefaultCompression, true
+	case PNGCompressionBestSpeed:
+		return png.BestSpeed, true
+	case PNGCompressionBest:
+		return png.BestCompression, true
+	case PNGCompressionNone:
+		return png.NoCompression, true
+	default:
+		return png.DefaultCompression, false
+	}
+}
+
+// Helper function to get the PNG compression level for a request's
+// setting, falling back to the server's when it is empty or unknown
+func (s *ImageService) pngCompression(name string) png.CompressionLevel {
+	if level, ok := pngCompressionLevel(name); ok && name != "" {
+		return level
+	}
+	level, _ := pngCompressionLevel(s.cfg.PNGCompression)
+	return level
+}
+
 // Helper function to get content type from image format
 func getContentType(format string) string {
 	switch format {
@@ -166,6 +1351,10 @@ func getContentType(format string) string {
 		return "image/jpeg"
 	case "png":
 		return "image/png"
+	case "webp":
+		return "image/webp"
+	case "gif":
+		return "image/gif"
 	default:
 		return "application/octet-stream"
 	}
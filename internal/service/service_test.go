@@ -0,0 +1,570 @@
+// internal/service/service_test.go
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"image-upload-server/internal/config"
+	"image-upload-server/internal/models"
+	"image-upload-server/internal/repository"
+	"image-upload-server/internal/repository/s3test"
+)
+
+// Helper function to create a service over local storage in a temporary
+// directory, with the server defaults adjusted by configure
+func newTestService(t *testing.T, configure func(*config.ImageConfig)) (*ImageService, repository.Storage) {
+	t.Helper()
+	repo, err := repository.NewLocalRepository(config.StorageConfig{LocalDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("creating local repository: %v", err)
+	}
+	return newServiceWithRepo(repo, configure), repo
+}
+
+// Helper function to create a service over an S3 repository backed by a
+// fake client, with the server defaults adjusted by configure
+func newFakeS3Service(t *testing.T, configure func(*config.ImageConfig)) (*ImageService, *s3test.FakeS3) {
+	t.Helper()
+	fake := s3test.New()
+	s3cfg := config.New().S3
+	s3cfg.BucketName = "test-bucket"
+	return newServiceWithRepo(repository.NewS3RepositoryWithClient(fake, nil, s3cfg), configure), fake
+}
+
+// Helper function to create a service over a repository with the server
+// defaults adjusted by configure; failed uploads aren't retried
+func newServiceWithRepo(repo repository.Storage, configure func(*config.ImageConfig)) *ImageService {
+	cfg := config.New().Image
+	cfg.UploadAttempts = 1
+	if configure != nil {
+		configure(&cfg)
+	}
+	return NewImageService(repo, cfg, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// Helper function to encode a gradient JPEG of the given size
+func testJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("encoding test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Helper function to upload a test image as a tenant and return its key
+func uploadAs(t *testing.T, svc *ImageService, tenant string) string {
+	t.Helper()
+	resp, err := svc.ProcessAndUploadImage(context.Background(), testJPEG(t, 400, 300), "photo.jpg",
+		[]models.CompressSpec{{Width: 100, Height: 75}}, UploadOptions{Tenant: tenant})
+	if err != nil {
+		t.Fatalf("uploading as %q: %v", tenant, err)
+	}
+	return resp.OriginalImage.Key
+}
+
+func TestProcessAndUploadImage(t *testing.T) {
+	specs := []models.CompressSpec{{Width: 200, Height: 150}, {Width: 100, Height: 75, Format: "png"}}
+
+	tests := []struct {
+		name         string
+		file         []byte
+		failPut      string // Substring of the keys whose puts fail
+		wantErr      bool
+		wantVariants int
+		wantFailed   int
+		wantStored   int
+	}{
+		{name: "success", file: testJPEG(t, 400, 300), wantVariants: 2, wantStored: 3},
+		{name: "decode failure", file: []byte("not an image"), wantErr: true},
+		{name: "partial compression failure", file: testJPEG(t, 400, 300), failPut: "_100x75", wantVariants: 1, wantFailed: 1, wantStored: 2},
+		{name: "original failure", file: testJPEG(t, 400, 300), failPut: "photo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, fake := newFakeS3Service(t, nil)
+			if tt.failPut != "" {
+				fake.FailPut = func(key string) error {
+					if strings.Contains(key, tt.failPut) {
+						return errors.New("injected put failure")
+					}
+					return nil
+				}
+			}
+
+			resp, err := svc.ProcessAndUploadImage(context.Background(), tt.file, "photo.jpg", specs, UploadOptions{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ProcessAndUploadImage succeeded, want an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("ProcessAndUploadImage: %v", err)
+				}
+				if len(resp.CompressedImages) != tt.wantVariants || len(resp.FailedSizes) != tt.wantFailed {
+					t.Errorf("got %d variants and %d failed sizes, want %d and %d",
+						len(resp.CompressedImages), len(resp.FailedSizes), tt.wantVariants, tt.wantFailed)
+				}
+				for _, result := range append([]models.ImageResult{resp.OriginalImage}, resp.CompressedImages...) {
+					if _, ok := fake.Object(result.Key); !ok {
+						t.Errorf("%s is in the response but not stored", result.Key)
+					}
+				}
+			}
+			if stored := fake.Keys(); len(stored) != tt.wantStored {
+				t.Errorf("stored %v, want %d objects", stored, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestProcessAndUploadImageRemovesStoredOnPanic(t *testing.T) {
+	// A stretch check would reject the absurd size before it reaches the resizer
+	svc, fake := newFakeS3Service(t, func(cfg *config.ImageConfig) { cfg.MaxAspectDistortion = 0 })
+	specs := []models.CompressSpec{
+		{Width: 100, Height: 75},
+		// Too large for the resizer's buffers, which makes it panic
+		{Width: 1 << 62, Height: 1},
+	}
+
+	_, err := svc.ProcessAndUploadImage(context.Background(), testJPEG(t, 400, 300), "photo.jpg", specs, UploadOptions{})
+	if !errors.Is(err, ErrProcessingPanic) {
+		t.Fatalf("ProcessAndUploadImage error = %v, want %v", err, ErrProcessingPanic)
+	}
+	if stored := fake.Keys(); len(stored) != 0 {
+		t.Errorf("left %v behind after the panic", stored)
+	}
+}
+
+func TestProcessAndUploadImageRemovesStoredWhenStopped(t *testing.T) {
+	specs := []models.CompressSpec{{Width: 100, Height: 75}}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		// stop runs when the variant is about to be stored, once the original is
+		stop    func(cancel context.CancelFunc) error
+		wantErr error
+	}{
+		{
+			name: "client cancellation",
+			stop: func(cancel context.CancelFunc) error {
+				cancel()
+				return context.Canceled
+			},
+			wantErr: context.Canceled,
+		},
+		{
+			name:    "processing timeout",
+			timeout: 20 * time.Millisecond,
+			stop: func(context.CancelFunc) error {
+				time.Sleep(100 * time.Millisecond)
+				return errors.New("too slow")
+			},
+			wantErr: ErrProcessingTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, fake := newFakeS3Service(t, func(cfg *config.ImageConfig) { cfg.ProcessingTimeout = tt.timeout })
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			fake.FailPut = func(key string) error {
+				if strings.Contains(key, "_100x75") {
+					return tt.stop(cancel)
+				}
+				return nil
+			}
+
+			_, err := svc.ProcessAndUploadImage(ctx, testJPEG(t, 400, 300), "photo.jpg", specs, UploadOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ProcessAndUploadImage error = %v, want %v", err, tt.wantErr)
+			}
+			if stored := fake.Keys(); len(stored) != 0 {
+				t.Errorf("left %v behind", stored)
+			}
+		})
+	}
+}
+
+func TestAbortedReuploadKeepsContentNamedObjects(t *testing.T) {
+	svc, fake := newFakeS3Service(t, func(cfg *config.ImageConfig) { cfg.KeyNaming = KeyNamingContent })
+	file := testJPEG(t, 400, 300)
+	specs := []models.CompressSpec{{Width: 100, Height: 75}}
+
+	first, err := svc.ProcessAndUploadImage(context.Background(), file, "photo.jpg", specs, UploadOptions{})
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	want := fake.Keys()
+
+	// The same bytes again with one more size, abandoned by the client
+	// while that size is stored
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake.FailPut = func(key string) error {
+		if strings.Contains(key, "_50x") {
+			cancel()
+			return context.Canceled
+		}
+		return nil
+	}
+	respecs := append(specs, models.CompressSpec{Width: 50, Height: 38})
+	if _, err := svc.ProcessAndUploadImage(ctx, file, "photo.jpg", respecs, UploadOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("second upload error = %v, want %v", err, context.Canceled)
+	}
+
+	for _, result := range append([]models.ImageResult{first.OriginalImage}, first.CompressedImages...) {
+		if _, ok := fake.Object(result.Key); !ok {
+			t.Errorf("%s of the first upload was removed", result.Key)
+		}
+	}
+	if got := fake.Keys(); !slices.Equal(got, want) {
+		t.Errorf("stored %v after the aborted upload, want %v", got, want)
+	}
+}
+
+func TestGetImageInfoScopedToTenant(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+	key := uploadAs(t, svc, "alice")
+
+	tests := []struct {
+		name    string
+		tenant  string
+		wantErr error
+	}{
+		{name: "owner", tenant: "alice"},
+		{name: "unauthenticated", tenant: ""},
+		{name: "other tenant", tenant: "bob", wantErr: ErrImageNotFound},
+		{name: "tenant sharing a prefix", tenant: "ali", wantErr: ErrImageNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.GetImageInfo(context.Background(), tt.tenant, key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetImageInfo(%q) error = %v, want %v", tt.tenant, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenImageScopedToTenant(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+	key := uploadAs(t, svc, "alice")
+
+	if _, err := svc.OpenImage(context.Background(), "bob", key, ""); !errors.Is(err, ErrImageNotFound) {
+		t.Fatalf("OpenImage as another tenant error = %v, want %v", err, ErrImageNotFound)
+	}
+	stream, err := svc.OpenImage(context.Background(), "alice", key, "")
+	if err != nil {
+		t.Fatalf("OpenImage as the owner: %v", err)
+	}
+	stream.Body.Close()
+}
+
+func TestSignedURLScopedToTenant(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+	key := uploadAs(t, svc, "alice")
+
+	_, err := svc.SignedURL(context.Background(), "bob", key, 0, repository.ResponseOverrides{})
+	if !errors.Is(err, ErrImageNotFound) {
+		t.Fatalf("SignedURL as another tenant error = %v, want %v", err, ErrImageNotFound)
+	}
+}
+
+func TestDeleteImageRefusesOtherTenants(t *testing.T) {
+	svc, repo := newTestService(t, nil)
+	key := uploadAs(t, svc, "alice")
+
+	if err := svc.DeleteImage(context.Background(), "bob", key, true); !errors.Is(err, ErrImageNotFound) {
+		t.Fatalf("DeleteImage as another tenant error = %v, want %v", err, ErrImageNotFound)
+	}
+	if _, err := repo.GetFile(context.Background(), key); err != nil {
+		t.Fatalf("image was removed by another tenant: %v", err)
+	}
+
+	if err := svc.DeleteImage(context.Background(), "alice", key, true); err != nil {
+		t.Fatalf("DeleteImage as the owner: %v", err)
+	}
+	if _, err := repo.GetFile(context.Background(), key); !repository.IsNotFound(err) {
+		t.Fatalf("image still stored after delete, error = %v", err)
+	}
+}
+
+func TestMoveImage(t *testing.T) {
+	svc, repo := newTestService(t, nil)
+	key := uploadAs(t, svc, "alice")
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		tenant      string
+		destination string
+		wantErr     error
+	}{
+		{name: "source of another tenant", tenant: "bob", destination: "bob/cover.jpg", wantErr: ErrImageNotFound},
+		{name: "destination of another tenant", tenant: "alice", destination: "bob/cover.jpg", wantErr: ErrInvalidSpec},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.MoveImage(ctx, tt.tenant, key, tt.destination, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MoveImage error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	variants, err := svc.variantKeys(ctx, key)
+	if err != nil || len(variants) != 1 {
+		t.Fatalf("variantKeys = %v, %v; want one variant", variants, err)
+	}
+	destination := joinKey(path.Dir(key), "moved", "cover.jpg")
+	result, err := svc.MoveImage(ctx, "alice", key, destination, nil)
+	if err != nil {
+		t.Fatalf("MoveImage: %v", err)
+	}
+	if result.Key != destination {
+		t.Errorf("moved image key = %q, want %q", result.Key, destination)
+	}
+
+	for _, old := range append([]string{key}, variants...) {
+		if _, err := repo.GetFile(ctx, old); !repository.IsNotFound(err) {
+			t.Errorf("%s still stored after the move, error = %v", old, err)
+		}
+	}
+	moved, err := svc.variantKeys(ctx, destination)
+	if err != nil || len(moved) != 1 {
+		t.Fatalf("variants of the destination = %v, %v; want the moved variant", moved, err)
+	}
+	if want := joinKey(path.Dir(destination), "cover_100x75.jpg"); moved[0] != want {
+		t.Errorf("moved variant key = %q, want %q", moved[0], want)
+	}
+}
+
+func TestMoveImageDropsReplacedVariants(t *testing.T) {
+	svc, repo := newTestService(t, nil)
+	ctx := context.Background()
+	key := uploadAs(t, svc, "")
+	replaced, err := svc.ProcessAndUploadImage(ctx, testJPEG(t, 400, 300), "photo.jpg",
+		[]models.CompressSpec{{Width: 100, Height: 75}, {Width: 50, Height: 38}}, UploadOptions{})
+	if err != nil {
+		t.Fatalf("uploading the destination: %v", err)
+	}
+	destination := replaced.OriginalImage.Key
+	// An on-demand variant cached for the image about to be replaced
+	svc.cfg.LazyVariants = true
+	if _, err := svc.Variant(ctx, "", destination, models.CompressSpec{Width: 40, Height: 30}); err != nil {
+		t.Fatalf("Variant: %v", err)
+	}
+	stale, err := svc.variantKeys(ctx, destination)
+	if err != nil || len(stale) != 3 {
+		t.Fatalf("variants of the destination = %v, %v; want three", stale, err)
+	}
+
+	overwrite := true
+	if _, err := svc.MoveImage(ctx, "", key, destination, &overwrite); err != nil {
+		t.Fatalf("MoveImage: %v", err)
+	}
+
+	variants, err := svc.variantKeys(ctx, destination)
+	if err != nil {
+		t.Fatalf("variantKeys: %v", err)
+	}
+	if want := []string{replaced.CompressedImages[0].Key}; !slices.Equal(variants, want) {
+		t.Errorf("variants after the move = %v, want only the moved %v", variants, want)
+	}
+	if _, err := repo.GetFile(ctx, replaced.CompressedImages[1].Key); !repository.IsNotFound(err) {
+		t.Errorf("%s of the replaced image still stored, error = %v", replaced.CompressedImages[1].Key, err)
+	}
+}
+
+func TestObjectKeyNormalizesSlashes(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		folder string
+		want   string
+	}{
+		{name: "plain", prefix: "uploads", folder: "sub", want: "uploads/sub/photo.jpg"},
+		{name: "trailing slash on prefix", prefix: "uploads/", folder: "sub", want: "uploads/sub/photo.jpg"},
+		{name: "repeated slashes", prefix: "uploads//", folder: "//sub///deeper/", want: "uploads/sub/deeper/photo.jpg"},
+		{name: "leading slashes", prefix: "/uploads", folder: "/sub", want: "uploads/sub/photo.jpg"},
+		{name: "no prefix", prefix: "", folder: "sub/", want: "sub/photo.jpg"},
+		{name: "no folder", prefix: "uploads/", folder: "", want: "uploads/photo.jpg"},
+		{name: "only slashes", prefix: "/", folder: "///", want: "photo.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestService(t, func(cfg *config.ImageConfig) {
+				cfg.Environment = ""
+				cfg.KeyPrefix = tt.prefix
+				cfg.FormatPrefixes = nil
+			})
+			if got := svc.objectKey("jpeg", UploadOptions{Folder: tt.folder}, "photo.jpg"); got != tt.want {
+				t.Errorf("objectKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadKeysHaveNoEmptySegments(t *testing.T) {
+	svc, repo := newTestService(t, func(cfg *config.ImageConfig) {
+		cfg.Environment = "prod/"
+		cfg.KeyPrefix = "/uploads//"
+	})
+	resp, err := svc.ProcessAndUploadImage(context.Background(), testJPEG(t, 400, 300), "photo.jpg",
+		[]models.CompressSpec{{Width: 100, Height: 75}}, UploadOptions{Folder: "a//b/"})
+	if err != nil {
+		t.Fatalf("ProcessAndUploadImage: %v", err)
+	}
+	for _, result := range append([]models.ImageResult{resp.OriginalImage}, resp.CompressedImages...) {
+		if strings.Contains(result.Key, "//") || strings.HasPrefix(result.Key, "/") || !strings.HasPrefix(result.Key, "prod/uploads/") {
+			t.Errorf("key %q is not normalized", result.Key)
+		}
+		if _, err := repo.GetFile(context.Background(), result.Key); err != nil {
+			t.Errorf("%s not stored: %v", result.Key, err)
+		}
+	}
+}
+
+func TestGetImageInfoURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		region   string
+		wantBase string
+	}{
+		{name: "custom endpoint", endpoint: "http://localhost:9000", region: "us-east-1", wantBase: "http://localhost:9000/test-bucket/"},
+		{name: "AWS", region: "eu-west-1", wantBase: "https://test-bucket.s3.eu-west-1.amazonaws.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3cfg := config.New().S3
+			s3cfg.BucketName, s3cfg.Endpoint, s3cfg.Region = "test-bucket", tt.endpoint, tt.region
+			s3cfg.UsePresignedURLs = false
+			svc := newServiceWithRepo(repository.NewS3RepositoryWithClient(s3test.New(), nil, s3cfg), nil)
+
+			resp, err := svc.ProcessAndUploadImage(context.Background(), testJPEG(t, 400, 300), "photo.jpg",
+				[]models.CompressSpec{{Width: 100, Height: 75}}, UploadOptions{})
+			if err != nil {
+				t.Fatalf("ProcessAndUploadImage: %v", err)
+			}
+			info, err := svc.GetImageInfo(context.Background(), "", resp.OriginalImage.Key)
+			if err != nil {
+				t.Fatalf("GetImageInfo: %v", err)
+			}
+
+			if want := tt.wantBase + resp.OriginalImage.Key; info.URL != want {
+				t.Errorf("GetImageInfo URL = %q, want %q", info.URL, want)
+			}
+			if info.URL != resp.OriginalImage.URL {
+				t.Errorf("GetImageInfo URL %q differs from the upload's %q", info.URL, resp.OriginalImage.URL)
+			}
+		})
+	}
+}
+
+func TestContentNamedReuploadKeepsExistingBytes(t *testing.T) {
+	svc, fake := newFakeS3Service(t, func(cfg *config.ImageConfig) { cfg.KeyNaming = KeyNamingContent })
+	file := testJPEG(t, 400, 300)
+	specs := []models.CompressSpec{{Width: 100, Height: 75}}
+
+	first, err := svc.ProcessAndUploadImage(context.Background(), file, "photo.jpg", specs, UploadOptions{Quality: 90})
+	if err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	firstVariant, _ := fake.Object(first.CompressedImages[0].Key)
+
+	// Other settings make other variant keys
+	other, err := svc.ProcessAndUploadImage(context.Background(), file, "photo.jpg", specs, UploadOptions{Quality: 40, Brightness: 20})
+	if err != nil {
+		t.Fatalf("upload with other settings: %v", err)
+	}
+	if other.OriginalImage.Key != first.OriginalImage.Key {
+		t.Errorf("original keys differ: %s and %s", first.OriginalImage.Key, other.OriginalImage.Key)
+	}
+	if other.CompressedImages[0].Key == first.CompressedImages[0].Key {
+		t.Errorf("both uploads stored their variant under %s", first.CompressedImages[0].Key)
+	}
+	if got, _ := fake.Object(first.CompressedImages[0].Key); !bytes.Equal(got, firstVariant) {
+		t.Errorf("the bytes behind %s changed", first.CompressedImages[0].Key)
+	}
+
+	// The same settings again write nothing
+	puts := 0
+	fake.FailPut = func(string) error {
+		puts++
+		return nil
+	}
+	again, err := svc.ProcessAndUploadImage(context.Background(), file, "photo.jpg", specs, UploadOptions{Quality: 90})
+	if err != nil {
+		t.Fatalf("repeated upload: %v", err)
+	}
+	if puts != 0 {
+		t.Errorf("repeated upload made %d puts, want none", puts)
+	}
+	if again.CompressedImages[0].URL != first.CompressedImages[0].URL {
+		t.Errorf("variant URL = %s, want %s", again.CompressedImages[0].URL, first.CompressedImages[0].URL)
+	}
+}
+
+func TestVariantRejectsUnboundedRequests(t *testing.T) {
+	svc, _ := newTestService(t, func(cfg *config.ImageConfig) { cfg.LazyVariants = true })
+	key := uploadAs(t, svc, "")
+	ctx := context.Background()
+
+	if _, err := svc.Variant(ctx, "", key, models.CompressSpec{Width: 100000, Height: 100000}); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("oversized variant error = %v, want %v", err, ErrInvalidSpec)
+	}
+
+	spec := models.CompressSpec{Width: 100, Height: 75}
+	if _, err := svc.Variant(ctx, "", key, spec); err != nil {
+		t.Fatalf("Variant: %v", err)
+	}
+	if _, err := svc.Variant(ctx, "", cachedVariantKey(key, spec), spec); !errors.Is(err, ErrInvalidSpec) {
+		t.Errorf("variant of a cached variant error = %v, want %v", err, ErrInvalidSpec)
+	}
+}
+
+func TestTenantSegmentIsInjective(t *testing.T) {
+	pairs := [][2]string{
+		{"auth0|42", "auth0_42"},
+		{"a@b", "a_b"},
+		{"a@b", "a_40b"},
+		{"user.name", "user_name"},
+	}
+	for _, pair := range pairs {
+		if a, b := tenantSegment(pair[0]), tenantSegment(pair[1]); a == b {
+			t.Errorf("tenants %q and %q share the segment %q", pair[0], pair[1], a)
+		}
+	}
+	for _, tenant := range []string{".", ".."} {
+		if segment := tenantSegment(tenant); strings.Trim(segment, ".") == "" {
+			t.Errorf("tenant %q has the segment %q", tenant, segment)
+		}
+	}
+
+	svc, _ := newTestService(t, nil)
+	key := uploadAs(t, svc, "auth0|42")
+	if _, err := svc.GetImageInfo(context.Background(), "auth0_42", key); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("GetImageInfo as a look-alike tenant error = %v, want %v", err, ErrImageNotFound)
+	}
+}
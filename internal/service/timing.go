@@ -0,0 +1,67 @@
+// internal/service/timing.go
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stageTimings accumulates how long each processing stage took, in
+// first-seen order; stages may be tracked from several goroutines
+type stageTimings struct {
+	start  time.Time
+	mu     sync.Mutex
+	order  []string
+	stages map[string]time.Duration
+}
+
+func newStageTimings() *stageTimings {
+	return &stageTimings{
+		start:  time.Now(),
+		stages: make(map[string]time.Duration),
+	}
+}
+
+// track starts timing a stage; call the returned function when it ends.
+// Repeated stages (e.g. one resize per variant) add up, so with concurrent
+// variants a stage can exceed the wall time.
+func (t *stageTimings) track(stage string) func() {
+	begin := time.Now()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := t.stages[stage]; !ok {
+			t.order = append(t.order, stage)
+		}
+		t.stages[stage] += time.Since(begin)
+	}
+}
+
+// total is the wall time since the timings were created
+func (t *stageTimings) total() time.Duration {
+	return time.Since(t.start)
+}
+
+// milliseconds returns each stage's duration in milliseconds
+func (t *stageTimings) milliseconds() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ms := make(map[string]float64, len(t.stages))
+	for stage, d := range t.stages {
+		ms[stage] = float64(d.Microseconds()) / 1000
+	}
+	return ms
+}
+
+// String renders the breakdown as space-separated key=value pairs
+func (t *stageTimings) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.order))
+	for _, stage := range t.order {
+		parts = append(parts, fmt.Sprintf("%s=%s", stage, t.stages[stage].Round(time.Millisecond)))
+	}
+	return strings.Join(parts, " ")
+}
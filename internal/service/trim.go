@@ -0,0 +1,97 @@
+// internal/service/trim.go
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// DefaultTrimTolerance is the trim tolerance, in percent of full scale,
+// used when a request doesn't set one; enough to absorb scanner noise
+const DefaultTrimTolerance = 10
+
+// Helper function to check the trim tolerance is within range
+func validateTrim(tolerance float64) error {
+	if math.IsNaN(tolerance) || tolerance < 0 || tolerance > 100 {
+		return fmt.Errorf("%w: trim tolerance %g outside 0..100", ErrInvalidSpec, tolerance)
+	}
+	return nil
+}
+
+// trimBorders crops uniform borders off an image, like ImageMagick's -trim.
+// The top-left pixel is the border colour; pixels whose channels, alpha
+// included, are all within tolerance percent of full scale of it count as
+// border. It returns the image unchanged and false when nothing but border
+// would be left.
+func trimBorders(img image.Image, tolerance float64) (image.Image, bool) {
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return img, false
+	}
+
+	limit := int(tolerance / 100 * 255)
+	border := src.Pix[0:4]
+	isBorder := func(x, y int) bool {
+		pixel := src.Pix[src.PixOffset(x, y):]
+		if pixel[3] == 0 && border[3] == 0 {
+			return true // Fully transparent, whatever the colour channels hold
+		}
+		for c := 0; c < 4; c++ {
+			if diff := int(pixel[c]) - int(border[c]); diff > limit || diff < -limit {
+				return false
+			}
+		}
+		return true
+	}
+	uniformRow := func(y int) bool {
+		for x := 0; x < width; x++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	uniformColumn := func(x, top, bottom int) bool {
+		for y := top; y < bottom; y++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	top := 0
+	for top < height && uniformRow(top) {
+		top++
+	}
+	if top == height {
+		return img, false
+	}
+	bottom := height
+	for bottom > top && uniformRow(bottom-1) {
+		bottom--
+	}
+	left := 0
+	for left < width && uniformColumn(left, top, bottom) {
+		left++
+	}
+	right := width
+	for right > left && uniformColumn(right-1, top, bottom) {
+		right--
+	}
+
+	crop := image.Rect(left, top, right, bottom)
+	if crop == src.Bounds() {
+		return img, true
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(out, out.Bounds(), src, crop.Min, draw.Src)
+	return out, true
+}
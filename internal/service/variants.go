@@ -0,0 +1,595 @@
+// internal/service/variants.go
+package service
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nfnt/resize"
+
+	"image-upload-server/internal/config"
+	"image-upload-server/internal/models"
+)
+
+// Fit modes for specs with both a width and a height
+const (
+	FitFill    = "fill"    // Stretch to exactly WxH (the default)
+	FitContain = "contain" // Keep the aspect ratio and fit inside WxH
+	FitCover   = "cover"   // Keep the aspect ratio, fill WxH and crop the overflow
+
+	// fitPad keeps the aspect ratio, fits inside WxH and pads the rest; it
+	// is only chosen by the extreme aspect ratio policy
+	fitPad = "pad"
+)
+
+// Policies for cover specs whose aspect ratio is far from the source's
+const (
+	AspectPolicyCrop = "crop" // Crop around the centre as usual (the default)
+	AspectPolicyPad  = "pad"  // Fit the whole source inside and pad to the requested size
+	AspectPolicySkip = "skip" // Leave the variant out, with a warning
+)
+
+// Orders for the compressed images of a response
+const (
+	SortRequest  = "request"   // As listed in compress_sizes (the default)
+	SortAreaAsc  = "area_asc"  // Smallest first
+	SortAreaDesc = "area_desc" // Largest first
+)
+
+// variantPlan is a compression spec with its output settings resolved
+type variantPlan struct {
+	spec     models.CompressSpec
+	format   string
+	quality  int  // Zero for lossless formats
+	clamped  bool // Quality was raised to the configured floor
+	lossless bool // Lossless WebP
+	// compression is the zlib level of PNG output
+	compression png.CompressionLevel
+	resize      resize.InterpolationFunction
+	// interpolation is the name of resize, e.g. "lanczos3"
+	interpolation string
+	fit           string
+	scaleX        float64 // Effective scale applied to the source, target over source
+	scaleY        float64
+	// aspectPolicy is the extreme aspect ratio policy applied to the spec, if any
+	aspectPolicy string
+	// tag tells apart the keys of plans of the same size and format that
+	// differ in other settings, such as quality; empty for the first, except
+	// with content naming, where every plan is tagged with its settings
+	tag   string
+	notes []string // Adjustments worth surfacing, e.g. an avoided upscale
+}
+
+// variantIdentity is what makes two resolved plans produce the same output
+type variantIdentity struct {
+	width, height int
+	format        string
+	quality       int
+	lossless      bool
+	fit           string
+	interpolation string
+}
+
+// identity returns the plan's output-determining settings
+func (p variantPlan) identity() variantIdentity {
+	return variantIdentity{
+		width:    p.spec.Width,
+		height:   p.spec.Height,
+		format:   p.format,
+		quality:  p.quality,
+		lossless: p.lossless,
+		fit:      p.fit,
+		// Resize functions can't be compared, so plans compare by name
+		interpolation: p.interpolation,
+	}
+}
+
+// planVariants resolves and validates every spec before anything is stored.
+// Nil specs fall back to the preset, if the request or its profile names one.
+// Specs left out by the extreme aspect ratio policy are reported in skipped.
+func (s *ImageService) planVariants(specs []models.CompressSpec, opts UploadOptions, sourceFormat string, source image.Image) (plans []variantPlan, skipped []string, err error) {
+	sourceBounds := source.Bounds()
+	profile, err := s.profile(opts.Profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if specs == nil {
+		if specs, err = presetSpecs(profile, opts.Preset); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	defaultFormat := sourceFormat
+	if requested := cmp.Or(opts.Format, profile.Format); strings.EqualFold(requested, FormatAuto) {
+		defaultFormat = FormatAuto
+	} else if requested != "" {
+		format, ok := normalizeFormat(requested)
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: unsupported output format %q", ErrInvalidSpec, requested)
+		}
+		defaultFormat = format
+	}
+
+	quality := cmp.Or(opts.Quality, profile.Quality, s.cfg.Quality)
+	reduction := 0
+	if opts.SaveData {
+		reduction = max(s.cfg.SaveDataQualityReduction, 0)
+	}
+	algorithm := s.resizeAlgorithmName(profile)
+	interpolation, _ := resizeAlgorithm(algorithm)
+	compression := s.pngCompression(opts.PNGCompression)
+	// The content is analyzed at most once, by the first auto spec
+	var content *contentProfile
+	// Plan index of each distinct variant, to drop repeats
+	seen := make(map[variantIdentity]int)
+
+	plans = make([]variantPlan, 0, len(specs))
+	for i, spec := range specs {
+		if spec.Quality < 0 || spec.Quality > 100 {
+			return nil, nil, fmt.Errorf("%w: compress_sizes[%d] quality %d outside 1..100", ErrInvalidSpec, i, spec.Quality)
+		}
+		if spec.Width < 0 || spec.Height < 0 || (spec.Width == 0 && spec.Height == 0) {
+			return nil, nil, fmt.Errorf("%w: compress_sizes[%d] %dx%d needs a positive width or height; set the other to 0 to keep the aspect ratio",
+				ErrInvalidSpec, i, spec.Width, spec.Height)
+		}
+
+		plan := variantPlan{spec: spec, format: defaultFormat, resize: interpolation, interpolation: algorithm, compression: compression}
+		if spec.Interpolation != "" {
+			var ok bool
+			if plan.resize, ok = resizeAlgorithm(spec.Interpolation); !ok {
+				return nil, nil, fmt.Errorf("%w: compress_sizes[%d] has unsupported interpolation %q; use nearest, bilinear, bicubic, mitchell, lanczos2 or lanczos3",
+					ErrInvalidSpec, i, spec.Interpolation)
+			}
+			plan.interpolation = strings.ToLower(strings.TrimSpace(spec.Interpolation))
+		}
+		// Resolve a zero dimension up front, so limits, names and results use the real size
+		plan.spec.Width, plan.spec.Height = proportionalSize(spec.Width, spec.Height, sourceBounds.Dx(), sourceBounds.Dy())
+		if s.cfg.NoUpscale {
+			resolved := plan.spec
+			plan.spec.Width, plan.spec.Height = fitWithin(resolved.Width, resolved.Height, sourceBounds.Dx(), sourceBounds.Dy())
+			if plan.spec != resolved {
+				plan.notes = append(plan.notes, fmt.Sprintf("%dx%d reduced to %dx%d to avoid upscaling",
+					resolved.Width, resolved.Height, plan.spec.Width, plan.spec.Height))
+			}
+		}
+
+		switch plan.fit = strings.ToLower(cmp.Or(spec.Fit, FitFill)); plan.fit {
+		case FitFill:
+			if distortion := aspectDistortion(plan.spec, sourceBounds); s.cfg.MaxAspectDistortion > 0 && distortion > s.cfg.MaxAspectDistortion {
+				return nil, nil, fmt.Errorf("%w: compress_sizes[%d] %dx%d would stretch the %dx%d source %.1fx (limit %.1fx); use fit contain or cover",
+					ErrInvalidSpec, i, plan.spec.Width, plan.spec.Height, sourceBounds.Dx(), sourceBounds.Dy(), distortion, s.cfg.MaxAspectDistortion)
+			}
+		case FitContain:
+			if plan.spec.Width > 0 && plan.spec.Height > 0 {
+				plan.spec.Width, plan.spec.Height = containWithin(sourceBounds.Dx(), sourceBounds.Dy(), plan.spec.Width, plan.spec.Height)
+			}
+		case FitCover:
+			if distortion := aspectDistortion(plan.spec, sourceBounds); s.cfg.ExtremeAspectRatio > 0 && distortion > s.cfg.ExtremeAspectRatio {
+				switch plan.aspectPolicy = s.extremeAspectPolicy(); plan.aspectPolicy {
+				case AspectPolicyPad:
+					plan.fit = fitPad
+				case AspectPolicySkip:
+					skipped = append(skipped, fmt.Sprintf("compress_sizes[%d] %dx%d skipped: the %dx%d source's aspect ratio differs %.1fx (limit %.1fx)",
+						i, plan.spec.Width, plan.spec.Height, sourceBounds.Dx(), sourceBounds.Dy(), distortion, s.cfg.ExtremeAspectRatio))
+					continue
+				}
+			}
+		default:
+			return nil, nil, fmt.Errorf("%w: compress_sizes[%d] has unsupported fit %q", ErrInvalidSpec, i, spec.Fit)
+		}
+
+		plan.scaleX, plan.scaleY = planScale(plan.spec, plan.fit, sourceBounds)
+
+		if strings.EqualFold(spec.Format, FormatAuto) {
+			plan.format = FormatAuto
+		} else if spec.Format != "" {
+			format, ok := normalizeFormat(spec.Format)
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: compress_sizes[%d] has unsupported format %q", ErrInvalidSpec, i, spec.Format)
+			}
+			plan.format = format
+		}
+
+		// An explicit lossless request on an auto spec settles it on WebP
+		if plan.format == FormatAuto {
+			if content == nil {
+				analyzed := analyzeContent(source)
+				content = &analyzed
+			}
+			plan.format = content.format()
+			if spec.Lossless != nil && *spec.Lossless {
+				plan.format = "webp"
+			}
+			plan.notes = append(plan.notes, fmt.Sprintf("%dx%d auto format chose %s (%s)",
+				plan.spec.Width, plan.spec.Height, plan.format, content))
+		}
+
+		// Lossless WebP is typically far smaller than lossy for flat-colour
+		// graphics and screenshots, and larger for photos
+		plan.lossless = plan.format == "webp" && opts.Lossless
+		if spec.Lossless != nil {
+			if *spec.Lossless && plan.format != "webp" {
+				return nil, nil, fmt.Errorf("%w: compress_sizes[%d] requests lossless but only webp supports it", ErrInvalidSpec, i)
+			}
+			plan.lossless = *spec.Lossless
+		}
+
+		if limit, ok := s.cfg.MaxDimensions[plan.format]; ok {
+			width, height := plan.spec.Width, plan.spec.Height
+			if (limit.Width > 0 && width > limit.Width) || (limit.Height > 0 && height > limit.Height) {
+				return nil, nil, fmt.Errorf("%w: compress_sizes[%d] %dx%d exceeds the %s limit of %dx%d",
+					ErrInvalidSpec, i, width, height, plan.format, limit.Width, limit.Height)
+			}
+		}
+
+		if plan.format == "jpeg" || (plan.format == "webp" && !plan.lossless) {
+			plan.quality, plan.clamped = s.effectiveQuality(cmp.Or(spec.Quality, quality) - reduction)
+			if plan.clamped {
+				plan.notes = append(plan.notes, fmt.Sprintf("%dx%d %s quality raised to the minimum of %d",
+					plan.spec.Width, plan.spec.Height, plan.format, plan.quality))
+			}
+		}
+
+		// Only a repeat of everything that shapes the output is dropped, so
+		// the same size in two formats or qualities still yields both
+		if s.cfg.DedupSpecs {
+			identity := plan.identity()
+			if kept, ok := seen[identity]; ok {
+				plans[kept].notes = append(plans[kept].notes, fmt.Sprintf("compress_sizes[%d] repeats %dx%d %s and was skipped",
+					i, plan.spec.Width, plan.spec.Height, plan.format))
+				continue
+			}
+			seen[identity] = len(plans)
+		}
+
+		plans = append(plans, plan)
+	}
+
+	tagCollisions(plans)
+	if s.cfg.KeyNaming == KeyNamingContent {
+		s.tagSettings(plans, opts)
+	}
+	return plans, skipped, nil
+}
+
+// contentIdentity is everything that shapes the bytes of a variant besides
+// the source: the plan's own settings and the adjustments made before resizing
+type contentIdentity struct {
+	variant       variantIdentity
+	compression   png.CompressionLevel
+	aspectPolicy  string
+	pipeline      []string
+	brightness    float64
+	contrast      float64
+	trim          bool
+	trimTolerance float64
+}
+
+// tagSettings gives every plan of a content-named upload a short hash of
+// its contentIdentity. Content naming keys the original by its bytes alone,
+// so without it a re-upload with other settings would land on the same
+// variant keys and change the bytes behind URLs meant to be immutable.
+func (s *ImageService) tagSettings(plans []variantPlan, opts UploadOptions) {
+	for i := range plans {
+		identity := contentIdentity{
+			variant:      plans[i].identity(),
+			compression:  plans[i].compression,
+			aspectPolicy: plans[i].aspectPolicy,
+			pipeline:     s.cfg.Pipeline,
+			brightness:   opts.Brightness,
+			contrast:     opts.Contrast,
+			trim:         opts.Trim,
+		}
+		if opts.Trim {
+			identity.trimTolerance = opts.TrimTolerance
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", identity)))
+		plans[i].tag = hex.EncodeToString(sum[:4])
+	}
+}
+
+// tagCollisions gives every plan after the first of its size and format a
+// short hash of its identity, so plans that survive deduplication because
+// they differ in, say, quality or fit are stored under keys of their own
+// rather than overwriting each other
+func tagCollisions(plans []variantPlan) {
+	type slot struct {
+		width, height int
+		format        string
+	}
+	taken := make(map[slot]bool, len(plans))
+	for i := range plans {
+		key := slot{plans[i].spec.Width, plans[i].spec.Height, plans[i].format}
+		if taken[key] {
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%+v", plans[i].identity())))
+			plans[i].tag = hex.EncodeToString(sum[:4])
+		}
+		taken[key] = true
+	}
+}
+
+// profile looks up a processing profile by name; the empty name is the zero profile
+func (s *ImageService) profile(name string) (config.Profile, error) {
+	if name == "" {
+		return config.Profile{}, nil
+	}
+
+	profile, ok := s.cfg.Profiles[name]
+	if !ok {
+		return config.Profile{}, fmt.Errorf("%w: unknown profile %q", ErrInvalidSpec, name)
+	}
+	return profile, nil
+}
+
+// Helper function to get the configured extreme aspect ratio policy, crop
+// when it isn't one of the known ones
+func (s *ImageService) extremeAspectPolicy() string {
+	switch policy := strings.ToLower(s.cfg.ExtremeAspectPolicy); policy {
+	case AspectPolicyPad, AspectPolicySkip:
+		return policy
+	default:
+		return AspectPolicyCrop
+	}
+}
+
+// Helper function to expand a profile preset into specs
+func presetSpecs(profile config.Profile, preset string) ([]models.CompressSpec, error) {
+	name := cmp.Or(preset, profile.DefaultPreset)
+	if name == "" {
+		return nil, fmt.Errorf("%w: compress_sizes or a preset is required", ErrInvalidSpec)
+	}
+
+	sizes, ok := profile.Presets[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown preset %q", ErrInvalidSpec, name)
+	}
+
+	specs := make([]models.CompressSpec, len(sizes))
+	for i, size := range sizes {
+		specs[i] = models.CompressSpec{Width: size.Width, Height: size.Height}
+	}
+	return specs, nil
+}
+
+// Helper function to get the name of the resize algorithm a profile's
+// variants default to: the profile's, else the server's, else lanczos3
+// when neither is known
+func (s *ImageService) resizeAlgorithmName(profile config.Profile) string {
+	for _, name := range []string{profile.Resize, s.cfg.ResizeAlgorithm} {
+		if _, ok := resizeAlgorithm(name); ok && name != "" {
+			return strings.ToLower(strings.TrimSpace(name))
+		}
+	}
+	return "lanczos3"
+}
+
+// Helper function to map a resize algorithm name to its interpolation
+// function; the empty name is the default, Lanczos3. Roughly from fastest
+// and blockiest to slowest and sharpest: nearest, bilinear, bicubic,
+// mitchell, lanczos2, lanczos3.
+func resizeAlgorithm(name string) (resize.InterpolationFunction, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "lanczos3":
+		return resize.Lanczos3, true
+	case "lanczos2":
+		return resize.Lanczos2, true
+	case "mitchell":
+		return resize.MitchellNetravali, true
+	case "bicubic":
+		return resize.Bicubic, true
+	case "bilinear":
+		return resize.Bilinear, true
+	case "nearest":
+		return resize.NearestNeighbor, true
+	default:
+		return resize.Lanczos3, false
+	}
+}
+
+// Helper function to derive where an on-demand variant is cached: under the
+// original's key, named by a hash of the source key and the normalized
+// transform, e.g. "shoes/photo_1700000000000000000/3f9a1c2b7d4e5f60.webp".
+// Identical requests map to the same object however they spell the params.
+func cachedVariantKey(original string, spec models.CompressSpec) string {
+	ext := filepath.Ext(original)
+	format, ok := normalizeFormat(cmp.Or(spec.Format, strings.TrimPrefix(ext, ".")))
+	if !ok {
+		format = strings.ToLower(spec.Format)
+	}
+	fit := strings.ToLower(cmp.Or(spec.Fit, FitFill))
+	lossless := spec.Lossless != nil && *spec.Lossless
+
+	transform := fmt.Sprintf("source=%s\nwidth=%d\nheight=%d\nformat=%s\nfit=%s\nlossless=%t",
+		original, spec.Width, spec.Height, format, fit, lossless)
+	// Only an explicit quality or interpolation is part of the key, so
+	// earlier cached variants keep theirs
+	if spec.Quality != 0 {
+		transform += fmt.Sprintf("\nquality=%d", spec.Quality)
+	}
+	if spec.Interpolation != "" {
+		transform += "\ninterpolation=" + strings.ToLower(strings.TrimSpace(spec.Interpolation))
+	}
+	sum := sha256.Sum256([]byte(transform))
+
+	return strings.TrimSuffix(original, ext) + "/" + hex.EncodeToString(sum[:8]) + formatExtension(format)
+}
+
+// Helper function to sort results by pixel area; ties keep request order
+func sortResults(results []models.ImageResult, order string) {
+	if compare := resultOrder(order); compare != nil {
+		slices.SortStableFunc(results, compare)
+	}
+}
+
+// Helper function to get the comparison of results for an order, or nil
+// to keep request order
+func resultOrder(order string) func(a, b models.ImageResult) int {
+	byArea := func(a, b models.ImageResult) int {
+		return cmp.Compare(a.Width*a.Height, b.Width*b.Height)
+	}
+
+	switch order {
+	case SortAreaAsc:
+		return byArea
+	case SortAreaDesc:
+		return func(a, b models.ImageResult) int { return byArea(b, a) }
+	default:
+		return nil
+	}
+}
+
+// Helper function to resize an image for a plan, cropping the overflow
+// around the centre for cover and centring it on a padded canvas for pad
+func resizeForPlan(img image.Image, plan variantPlan) image.Image {
+	width, height := plan.spec.Width, plan.spec.Height
+	if plan.fit == fitPad && width > 0 && height > 0 {
+		return padToSize(img, plan)
+	}
+	if plan.fit != FitCover || width == 0 || height == 0 {
+		return resize.Resize(uint(width), uint(height), img, plan.resize)
+	}
+
+	bounds := img.Bounds()
+	scale := max(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+	scaledWidth := max(int(math.Round(float64(bounds.Dx())*scale)), width)
+	scaledHeight := max(int(math.Round(float64(bounds.Dy())*scale)), height)
+	scaled := resize.Resize(uint(scaledWidth), uint(scaledHeight), img, plan.resize)
+
+	cropped, ok := scaled.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return scaled
+	}
+	offset := image.Pt((scaledWidth-width)/2, (scaledHeight-height)/2).Add(scaled.Bounds().Min)
+	return cropped.SubImage(image.Rectangle{Min: offset, Max: offset.Add(image.Pt(width, height))})
+}
+
+// Helper function to fit an image inside a plan's size and centre it on a
+// canvas of exactly that size. The padding is transparent, or white for
+// JPEG, which has no alpha channel.
+func padToSize(img image.Image, plan variantPlan) image.Image {
+	bounds := img.Bounds()
+	width, height := containWithin(bounds.Dx(), bounds.Dy(), plan.spec.Width, plan.spec.Height)
+	scaled := resize.Resize(uint(width), uint(height), img, plan.resize)
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, plan.spec.Width, plan.spec.Height))
+	if plan.format == "jpeg" {
+		draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+	offset := image.Pt((plan.spec.Width-width)/2, (plan.spec.Height-height)/2)
+	draw.Draw(canvas, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(width, height))}, scaled, scaled.Bounds().Min, draw.Over)
+	return canvas
+}
+
+// Helper function to measure how much a fill resize stretches the source:
+// the ratio between the target and source aspect ratios, 1 meaning none
+func aspectDistortion(spec models.CompressSpec, sourceBounds image.Rectangle) float64 {
+	if spec.Width <= 0 || spec.Height <= 0 || sourceBounds.Empty() {
+		return 1
+	}
+
+	target := float64(spec.Width) / float64(spec.Height)
+	source := float64(sourceBounds.Dx()) / float64(sourceBounds.Dy())
+	return max(target/source, source/target)
+}
+
+// Helper function to get the scale factors a resize applies to the source,
+// target over source per axis, rounded to four decimals. Cover scales both
+// axes alike and crops the overflow, so it reports that uniform scale; pad
+// reports the uniform scale of the padded image.
+func planScale(spec models.CompressSpec, fit string, sourceBounds image.Rectangle) (float64, float64) {
+	if sourceBounds.Empty() {
+		return 0, 0
+	}
+
+	scaleX := float64(spec.Width) / float64(sourceBounds.Dx())
+	scaleY := float64(spec.Height) / float64(sourceBounds.Dy())
+	switch fit {
+	case FitCover:
+		scaleX = max(scaleX, scaleY)
+		scaleY = scaleX
+	case fitPad:
+		scaleX = min(scaleX, scaleY)
+		scaleY = scaleX
+	}
+	return math.Round(scaleX*1e4) / 1e4, math.Round(scaleY*1e4) / 1e4
+}
+
+// Helper function to get the largest size with the source's aspect ratio
+// that fits inside width x height
+func containWithin(sourceWidth, sourceHeight, width, height int) (int, int) {
+	scale := min(float64(width)/float64(sourceWidth), float64(height)/float64(sourceHeight))
+	return max(int(math.Round(float64(sourceWidth)*scale)), 1),
+		max(int(math.Round(float64(sourceHeight)*scale)), 1)
+}
+
+// Helper function to shrink a requested size that would upscale the source,
+// keeping the requested aspect ratio. A zero dimension stays zero so the
+// resizer still derives it from the source.
+func fitWithin(width, height, sourceWidth, sourceHeight int) (int, int) {
+	scale := 1.0
+	if width > sourceWidth {
+		scale = float64(sourceWidth) / float64(width)
+	}
+	if height > sourceHeight {
+		scale = min(scale, float64(sourceHeight)/float64(height))
+	}
+	if scale == 1 {
+		return width, height
+	}
+
+	return max(int(math.Round(float64(width)*scale)), min(width, 1)),
+		max(int(math.Round(float64(height)*scale)), min(height, 1))
+}
+
+// Helper function to resolve an output size, deriving a zero dimension from
+// the source's aspect ratio; with both zero it is the source size
+func proportionalSize(width, height, sourceWidth, sourceHeight int) (int, int) {
+	switch {
+	case width == 0 && height == 0:
+		return sourceWidth, sourceHeight
+	case width == 0:
+		return max(int(math.Round(float64(sourceWidth)*float64(height)/float64(sourceHeight))), 1), height
+	case height == 0:
+		return width, max(int(math.Round(float64(sourceHeight)*float64(width)/float64(sourceWidth))), 1)
+	default:
+		return width, height
+	}
+}
+
+// Helper function to map a requested format name to the decoder's format name
+func normalizeFormat(name string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "jpeg", "jpg":
+		return "jpeg", true
+	case "png":
+		return "png", true
+	case "webp":
+		return "webp", true
+	case "gif":
+		return "gif", true
+	default:
+		return "", false
+	}
+}
+
+// Helper function to get the file extension for an output format
+func formatExtension(format string) string {
+	switch format {
+	case "jpeg":
+		return ".jpg"
+	default:
+		return "." + format
+	}
+}
@@ -0,0 +1,79 @@
+// internal/service/variants_test.go
+package service
+
+import (
+	"context"
+	"testing"
+
+	"image-upload-server/internal/config"
+	"image-upload-server/internal/models"
+)
+
+func TestSameSizeVariantsGetDistinctKeys(t *testing.T) {
+	svc, repo := newTestService(t, func(cfg *config.ImageConfig) { cfg.DedupSpecs = true })
+	specs := []models.CompressSpec{
+		{Width: 200, Height: 150, Format: "jpeg", Quality: 40},
+		{Width: 200, Height: 150, Format: "jpeg", Quality: 90},
+	}
+
+	resp, err := svc.ProcessAndUploadImage(context.Background(), testJPEG(t, 400, 300), "photo.jpg", specs, UploadOptions{})
+	if err != nil {
+		t.Fatalf("ProcessAndUploadImage: %v", err)
+	}
+	if len(resp.CompressedImages) != 2 {
+		t.Fatalf("got %d variants, want 2", len(resp.CompressedImages))
+	}
+	first, second := resp.CompressedImages[0], resp.CompressedImages[1]
+	if first.Key == second.Key {
+		t.Fatalf("both variants stored under %q", first.Key)
+	}
+
+	sizes := make(map[string]int64)
+	for _, result := range resp.CompressedImages {
+		info, err := repo.GetFile(context.Background(), result.Key)
+		if err != nil {
+			t.Fatalf("reading %s: %v", result.Key, err)
+		}
+		sizes[result.Key] = info.Size
+	}
+	if sizes[first.Key] >= sizes[second.Key] {
+		t.Errorf("quality 40 variant is %d bytes, quality 90 is %d; expected the lower quality to be smaller", sizes[first.Key], sizes[second.Key])
+	}
+}
+
+func TestIdenticalSpecsStillDeduplicated(t *testing.T) {
+	svc, _ := newTestService(t, func(cfg *config.ImageConfig) { cfg.DedupSpecs = true })
+	specs := []models.CompressSpec{
+		{Width: 200, Height: 150, Format: "jpeg", Quality: 60},
+		{Width: 200, Height: 150, Format: "jpeg", Quality: 60},
+	}
+
+	resp, err := svc.ProcessAndUploadImage(context.Background(), testJPEG(t, 400, 300), "photo.jpg", specs, UploadOptions{})
+	if err != nil {
+		t.Fatalf("ProcessAndUploadImage: %v", err)
+	}
+	if len(resp.CompressedImages) != 1 {
+		t.Fatalf("got %d variants, want 1", len(resp.CompressedImages))
+	}
+}
+
+func TestInterpolationSeparatesVariantKeys(t *testing.T) {
+	svc, _ := newTestService(t, nil)
+	specs := []models.CompressSpec{
+		{Width: 200, Height: 150, Format: "png", Interpolation: "nearest"},
+		{Width: 200, Height: 150, Format: "png", Interpolation: "lanczos3"},
+		{Width: 200, Height: 150, Format: "png", Interpolation: "bilinear"},
+	}
+
+	resp, err := svc.ProcessAndUploadImage(context.Background(), testJPEG(t, 400, 300), "photo.jpg", specs, UploadOptions{})
+	if err != nil {
+		t.Fatalf("ProcessAndUploadImage: %v", err)
+	}
+	keys := make(map[string]bool)
+	for _, result := range resp.CompressedImages {
+		keys[result.Key] = true
+	}
+	if len(keys) != len(specs) {
+		t.Fatalf("got %d distinct keys for %d interpolations: %v", len(keys), len(specs), keys)
+	}
+}